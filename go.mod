@@ -1,14 +1,22 @@
 module github.com/AlexanderBrese/gomon
 
-go 1.16
+go 1.20
 
 require (
-	github.com/bmizerany/pat v0.0.0-20170815010413-6226ea591a40
-	github.com/creack/pty v1.1.11 // indirect
-	github.com/fatih/color v1.10.0 // indirect
+	github.com/creack/pty v1.1.11
+	github.com/fatih/color v1.10.0
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gorilla/websocket v1.4.2
-	github.com/imdario/mergo v0.3.11
 	github.com/pelletier/go-toml v1.8.1
+	go.uber.org/goleak v1.0.0
+	golang.org/x/sync v0.0.0-20220907140024-f12130a52804
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/mattn/go-colorable v0.1.8 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	golang.org/x/lint v0.0.0-20190930215403-16217165b5de // indirect
 	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2 // indirect
+	golang.org/x/tools v0.0.0-20191108193012-7d206e10da11 // indirect
 )
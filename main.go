@@ -1,45 +1,63 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
-	"github.com/AlexanderBrese/gomon/pkg/surveillance"
+	"github.com/AlexanderBrese/gomon/pkg/gomon"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
-var cfgPath string
+var (
+	cfgPath     string
+	profile     string
+	checkConfig bool
+	printSchema bool
+)
 
 func init() {
 	flag.StringVar(&cfgPath, "c", "", "relative config path")
+	flag.StringVar(&profile, "profile", "", "name of the configuration profile to apply")
+	flag.BoolVar(&checkConfig, "check-config", false, "check the configuration and exit non-zero on problems")
+	flag.BoolVar(&printSchema, "print-schema", false, "print the JSON Schema of the configuration and exit")
 	flag.Parse()
 }
 
 func main() {
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	if checkConfig {
+		os.Exit(check(cfgPath))
+	}
+	if printSchema {
+		schema, err := configuration.JSONSchema()
+		if err != nil {
+			log.Fatalf("error: during schema generation: %s", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	defer _recover()
 
-	cfg, err := parse(cfgPath)
+	cfg, err := parse(cfgPath, profile)
 	if err != nil {
 		log.Fatalf("error: during configuration parsing: %s", err)
 	}
 
-	gomon := surveillance.NewGomon(cfg)
-	if gomon == nil {
-		return
+	g, err := gomon.New(cfg)
+	if err != nil {
+		log.Fatalf("error: %s", err)
+	}
+	if err := g.Run(ctx); err != nil {
+		log.Fatalf("error: %s", err)
 	}
-
-	go func() {
-		<-sigs
-		gomon.Stop()
-	}()
-
-	gomon.Start()
 }
 
 func _recover() {
@@ -48,16 +66,52 @@ func _recover() {
 	}
 }
 
-func parse(cfgPath string) (*configuration.Configuration, error) {
-	absPath := ""
-	if cfgPath != "" {
-		var err error
-		absPath, err = utils.CurrentAbsolutePath(cfgPath)
-		if err != nil {
-			return nil, err
+func check(cfgPath string) int {
+	absPath, err := absolutePath(cfgPath)
+	if err == nil && absPath == "" {
+		absPath, err = configuration.Discover(configuration.DefaultConfiguration().Root)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return 1
+	}
+
+	name := absPath
+	if name == "" {
+		name = "default configuration"
+	}
+	problems, err := configuration.CheckConfiguration(absPath, profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 1
+	}
+	for _, p := range problems {
+		if p.Path == "" {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, p)
+			continue
 		}
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Printf("%s: ok\n", name)
+	return 0
+}
+
+func absolutePath(cfgPath string) (string, error) {
+	if cfgPath == "" {
+		return "", nil
+	}
+	return utils.CurrentAbsolutePath(cfgPath)
+}
+
+func parse(cfgPath string, profile string) (*configuration.Configuration, error) {
+	absPath, err := absolutePath(cfgPath)
+	if err != nil {
+		return nil, err
 	}
-	cfg, err := configuration.ParsedConfiguration(absPath)
+	cfg, err := configuration.ParsedProfileConfiguration(absPath, profile)
 	if err != nil {
 		return nil, err
 	}
@@ -44,7 +44,11 @@ func communicate(hub *Hub, w http.ResponseWriter, r *http.Request) error {
 	}
 
 	client := &Client{hub: hub, conn: conn, outboundMessage: make(chan []byte, outboundMessages)}
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.done:
+		return conn.Close()
+	}
 
 	defer func() {
 		if err := client.writeToSocket(); err != nil {
@@ -1,5 +1,7 @@
 package browsersync
 
+import "context"
+
 // Hub is a client switch that broadcasts messages
 type Hub struct {
 	// Registered clients
@@ -8,43 +10,43 @@ type Hub struct {
 	// Broadcast a message to all registered clients
 	broadcast chan []byte
 
+	// The number of clients the last broadcast message was delivered to
+	delivered chan int
+
 	// Register a new client
 	register chan *Client
 
-	stopListening chan bool
+	// Closed once the hub stopped listening
+	done chan struct{}
 }
 
 // NewHub creates a new Hub
 func NewHub() *Hub {
 	return &Hub{
-		clients:       make(map[*Client]bool),
-		broadcast:     make(chan []byte),
-		register:      make(chan *Client),
-		stopListening: make(chan bool, 1),
+		clients:   make(map[*Client]bool),
+		broadcast: make(chan []byte),
+		delivered: make(chan int, 1),
+		register:  make(chan *Client),
+		done:      make(chan struct{}),
 	}
 }
 
-func (h *Hub) stop() {
-	for client := range h.clients {
-		h.unregisterClient(client)
-	}
-	h.stopListening <- true
-}
-
-func (h *Hub) listen() {
-OuterLoop:
+// listen registers clients and broadcasts messages until the context is done
+func (h *Hub) listen(ctx context.Context) {
+	defer close(h.done)
 	for {
 		select {
-		case <-h.stopListening:
-			break OuterLoop
+		case <-ctx.Done():
+			for client := range h.clients {
+				h.unregisterClient(client)
+			}
+			return
 		case client := <-h.register:
 			h.registerClient(client)
 		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+			h.delivered <- h.broadcastMessage(message)
 		}
 	}
-	close(h.stopListening)
-
 }
 
 func (h *Hub) registerClient(client *Client) {
@@ -56,12 +58,15 @@ func (h *Hub) unregisterClient(client *Client) {
 	client.close()
 }
 
-func (h *Hub) broadcastMessage(message []byte) {
+func (h *Hub) broadcastMessage(message []byte) int {
+	delivered := 0
 	for client := range h.clients {
 		select {
 		case client.outboundMessage <- message:
+			delivered++
 		default:
 			h.unregisterClient(client)
 		}
 	}
+	return delivered
 }
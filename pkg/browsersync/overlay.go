@@ -0,0 +1,46 @@
+package browsersync
+
+// overlayScript connects to the overlay route of the host it was loaded from and renders the diagnostics
+// received in a box over the page, an empty list of diagnostics removes the box
+const overlayScript = `(function() {
+  var script = document.currentScript;
+  var address = "ws://" + new URL(script.src).host + "/overlay";
+  var box;
+
+  function render(diagnostics) {
+    if (box) {
+      box.remove();
+      box = null;
+    }
+    if (diagnostics.length === 0) {
+      return;
+    }
+    box = document.createElement("pre");
+    box.id = "gomon-overlay";
+    box.style.cssText = "position:fixed;bottom:0;left:0;right:0;max-height:40%;overflow:auto;margin:0;" +
+      "padding:1em;z-index:2147483647;background:rgba(30,30,30,0.95);color:#f88;font:12px monospace;";
+    box.textContent = diagnostics.map(function(d) {
+      var location = d.File + ":" + d.Line + (d.Column ? ":" + d.Column : "");
+      return location + ": " + d.Message + " (" + d.Command + ")";
+    }).join("\n");
+    box.onclick = function() { render([]); };
+    document.body.appendChild(box);
+  }
+
+  function connect() {
+    var conn = new WebSocket(address);
+    conn.onclose = function() {
+      setTimeout(connect, 2000);
+    };
+    conn.onmessage = function(evt) {
+      evt.data.split("\n").forEach(function(message) {
+        render(JSON.parse(message));
+      });
+    };
+  }
+
+  if (window["WebSocket"]) {
+    connect();
+  }
+})();
+`
@@ -3,71 +3,153 @@ package browsersync
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/AlexanderBrese/gomon/pkg/event"
 	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"golang.org/x/sync/errgroup"
 )
 
-const route = "/sync"
+const (
+	route = "/sync"
+	// overlayRoute is where the clients receive the lint diagnostics, kept apart from the sync route
+	// since clients of that reload on any message
+	overlayRoute = "/overlay"
+	// overlayScriptRoute serves a script rendering the diagnostics received over the page
+	overlayScriptRoute = "/overlay.js"
+	// to finish the requests in flight on shutdown
+	shutdownTimeout = 5 * time.Second
+)
 
 // Server serves a REST route the client connects to receive sync messages
 type Server struct {
-	hub    *Hub
-	srv    *http.Server
-	logger *logging.Logger
+	hub     *Hub
+	overlay *Hub
+	srv     *http.Server
+	mux     *http.ServeMux
+	logger  *logging.Logger
+	events  *event.Bus
 }
 
-// NewServer creates a new Server with the port provided
-func NewServer(port int, l *logging.Logger) *Server {
+// NewServer creates a new Server with the port provided, which syncs whenever the binary was started
+func NewServer(port int, l *logging.Logger, events *event.Bus) *Server {
+	mux := http.NewServeMux()
 	return &Server{
-		hub:    NewHub(),
-		srv:    &http.Server{Addr: fmt.Sprintf(":%d", port)},
-		logger: l,
+		hub:     NewHub(),
+		overlay: NewHub(),
+		srv:     &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux},
+		mux:     mux,
+		logger:  l,
+		events:  events,
 	}
 }
 
-// Start starts the server and lets the hub listen for clients
-func (s *Server) Start() {
-	s.startHub()
+// Run serves the clients until the context is done, then shuts the server down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	subscription := s.events.Subscribe()
+	defer subscription.Close()
 	s.setupRoute()
-	s.startServer()
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		s.hub.listen(ctx)
+		return nil
+	})
+	g.Go(func() error {
+		s.overlay.listen(ctx)
+		return nil
+	})
+	g.Go(func() error {
+		s.follow(ctx, subscription)
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return s.srv.Shutdown(shutdownCtx)
+	})
+	g.Go(func() error {
+		s.logger.Sync("Serving sync server at: %s", s.srv.Addr)
+		if err := s.srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("during sync server: %w", err)
+		}
+		return nil
+	})
+	return g.Wait()
 }
 
-// Sync sends a sync message to the clients
-func (s *Server) Sync() {
-	message := bytes.TrimSpace([]byte("sync"))
-	s.hub.broadcast <- message
+// Sync sends a sync message to the clients and returns the number of clients it was sent to
+func (s *Server) Sync(ctx context.Context) int {
+	return broadcast(ctx, s.hub, bytes.TrimSpace([]byte("sync")))
 }
 
-// Stop stops the hub and the server gracefully
-func (s *Server) Stop() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	s.hub.stop()
-	return s.srv.Shutdown(ctx)
+// Overlay sends the lint diagnostics to the overlay clients and returns the number of clients it was sent to.
+// No diagnostics clear the overlay.
+func (s *Server) Overlay(ctx context.Context, diagnostics []event.Diagnostic) int {
+	if diagnostics == nil {
+		diagnostics = []event.Diagnostic{}
+	}
+	message, err := json.Marshal(diagnostics)
+	if err != nil {
+		s.logger.Main("error: during overlay encoding: %s", err)
+		return 0
+	}
+	return broadcast(ctx, s.overlay, message)
+}
+
+// broadcast sends the message to the clients of the hub and returns the number of clients it was sent to
+func broadcast(ctx context.Context, hub *Hub, message []byte) int {
+	select {
+	case hub.broadcast <- message:
+		return <-hub.delivered
+	case <-ctx.Done():
+		return 0
+	case <-hub.done:
+		return 0
+	}
+}
+
+func (s *Server) follow(ctx context.Context, subscription *event.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-subscription.Events():
+			if !ok {
+				return
+			}
+			switch ev := ev.(type) {
+			case event.AppStarted:
+				clients := s.Sync(ctx)
+				s.events.Publish(event.SyncSent{At: time.Now(), Clients: clients, Timing: ev.Timing})
+			case event.LintFinished:
+				s.Overlay(ctx, ev.Diagnostics)
+			}
+		}
+	}
 }
 
 func (s *Server) setupRoute() {
-	http.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
+	s.mux.HandleFunc(route, func(w http.ResponseWriter, r *http.Request) {
 		if err := communicate(s.hub, w, r); err != nil {
 			s.logger.Main("error: failed to setup route: %s", err)
 			return
 		}
 	})
-}
-
-func (s *Server) startHub() {
-	go s.hub.listen()
-}
-
-func (s *Server) startServer() {
-	go func() {
-		if err := s.srv.ListenAndServe(); err != nil {
-			s.logger.Main("error: failed to serve sync server: %s", err)
+	s.mux.HandleFunc(overlayRoute, func(w http.ResponseWriter, r *http.Request) {
+		if err := communicate(s.overlay, w, r); err != nil {
+			s.logger.Main("error: failed to setup route: %s", err)
 			return
 		}
-		s.logger.Sync("Serving sync server at: %s", s.srv.Addr)
-	}()
+	})
+	s.mux.HandleFunc(overlayScriptRoute, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		_, _ = io.WriteString(w, overlayScript)
+	})
 }
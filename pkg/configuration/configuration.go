@@ -1,7 +1,9 @@
 package configuration
 
 import (
+	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/AlexanderBrese/gomon/pkg/utils"
@@ -19,53 +21,190 @@ func init() {
 }
 
 type LogConfiguration struct {
-	BuildLog       string `toml:"build_log_name"`
-	RelBuildLogDir string `toml:"relative_build_log_dir"`
-	Time           bool   `toml:"time"`
-	Main           bool   `toml:"main"`
-	Detection      bool   `toml:"detection"`
-	Build          bool   `toml:"build"`
-	Run            bool   `toml:"run"`
-	Sync           bool   `toml:"sync"`
-	App            bool   `toml:"app"`
+	BuildLog       string `toml:"build_log_name" yaml:"build_log_name" json:"build_log_name" comment:"What should the build log be named?"`
+	RelBuildLogDir string `toml:"relative_build_log_dir" yaml:"relative_build_log_dir" json:"relative_build_log_dir" comment:"Where should the build log be stored?"`
+	Time           bool   `toml:"time" yaml:"time" json:"time" comment:"Should a timestamp be appended to the log?"`
+	Main           bool   `toml:"main" yaml:"main" json:"main" comment:"Should the main log be enabled?"`
+	Detection      bool   `toml:"detection" yaml:"detection" json:"detection" comment:"Should the detection log be enabled?"`
+	Build          bool   `toml:"build" yaml:"build" json:"build" comment:"Should the build log be enabled?"`
+	Run            bool   `toml:"run" yaml:"run" json:"run" comment:"Should the run log be enabled?"`
+	Sync           bool   `toml:"sync" yaml:"sync" json:"sync" comment:"Should the sync log be enabled?"`
+	App            bool   `toml:"app" yaml:"app" json:"app" comment:"Should the app log be enabled?"`
+	Test           bool   `toml:"test" yaml:"test" json:"test" comment:"Should the test log be enabled?"`
+	Status         bool   `toml:"status" yaml:"status" json:"status" comment:"Should the status log be enabled?"`
 }
 
 type ColorConfiguration struct {
-	Main      string `toml:"main"`
-	Detection string `toml:"detection"`
-	Build     string `toml:"build"`
-	Run       string `toml:"run"`
-	Sync      string `toml:"sync"`
-	App       string `toml:"app"`
+	Main      string `toml:"main" yaml:"main" json:"main" comment:"The main log color"`
+	Detection string `toml:"detection" yaml:"detection" json:"detection" comment:"The detection log color"`
+	Build     string `toml:"build" yaml:"build" json:"build" comment:"The build log color"`
+	Run       string `toml:"run" yaml:"run" json:"run" comment:"The run log color"`
+	Sync      string `toml:"sync" yaml:"sync" json:"sync" comment:"The sync log color"`
+	App       string `toml:"app" yaml:"app" json:"app" comment:"The app log color"`
+	Test      string `toml:"test" yaml:"test" json:"test" comment:"The test log color"`
+	Status    string `toml:"status" yaml:"status" json:"status" comment:"The status log color"`
 }
 
 type BuildConfiguration struct {
-	Name             string `toml:"build_name"`
-	RelDir           string `toml:"relative_build_dir"`
-	RelSrcDir        string `toml:"relative_source_dir"`
-	ExecutionCommand string `toml:"execution_command"`
-	Command          string `toml:"build_command"`
-	EventBufferTime  int
-	KillDelay        int
-	Port             int `toml:"port"`
+	Name             string            `toml:"build_name" yaml:"build_name" json:"build_name" comment:"What should the build be named?"`
+	RelDir           string            `toml:"relative_build_dir" yaml:"relative_build_dir" json:"relative_build_dir" comment:"Where should the build be stored?"`
+	RelSrcDir        string            `toml:"relative_source_dir" yaml:"relative_source_dir" json:"relative_source_dir" comment:"What should we build from?"`
+	ExecutionCommand string            `toml:"execution_command" yaml:"execution_command" json:"execution_command" comment:"How should the build be run?"`
+	ExecutionArgs    []string          `toml:"execution_args" yaml:"execution_args" json:"execution_args" comment:"Which arguments should the build be run with instead of the execution command? {{.Binary}} is filled in"`
+	Shell            bool              `toml:"shell" yaml:"shell" json:"shell" comment:"Should the commands be run in a shell instead of being split into arguments?"`
+	Command          string            `toml:"build_command" yaml:"build_command" json:"build_command" comment:"How should the build be done? go build, or a command with {{.Binary}} and {{.SrcDir}} placeholders"`
+	Args             []string          `toml:"build_args" yaml:"build_args" json:"build_args" comment:"Which arguments should the build be done with instead of the build command? {{.Binary}} and {{.SrcDir}} are filled in"`
+	Flags            []string          `toml:"build_flags" yaml:"build_flags" json:"build_flags" comment:"Which flags should be passed to the build command?"`
+	Tags             []string          `toml:"tags" yaml:"tags" json:"tags" comment:"Which build tags should go build use?"`
+	Ldflags          string            `toml:"ldflags" yaml:"ldflags" json:"ldflags" comment:"Which flags should go build pass to the linker?"`
+	Gcflags          string            `toml:"gcflags" yaml:"gcflags" json:"gcflags" comment:"Which flags should go build pass to the compiler?"`
+	Race             bool              `toml:"race" yaml:"race" json:"race" comment:"Should go build enable the race detector?"`
+	Trimpath         bool              `toml:"trimpath" yaml:"trimpath" json:"trimpath" comment:"Should go build remove the file system paths from the binary?"`
+	CgoEnabled       string            `toml:"cgo_enabled" yaml:"cgo_enabled" json:"cgo_enabled" comment:"Should go build enable cgo? 1, 0 or empty for the default"`
+	Goos             string            `toml:"goos" yaml:"goos" json:"goos" comment:"Which operating system should go build for, empty for the current one?"`
+	Goarch           string            `toml:"goarch" yaml:"goarch" json:"goarch" comment:"Which architecture should go build for, empty for the current one?"`
+	Env              map[string]string `toml:"env" yaml:"env" json:"env" comment:"Which environment variables should be set for the build and the binary?"`
+	EventBufferTime  int               `toml:"event_buffer_time" yaml:"event_buffer_time" json:"event_buffer_time" comment:"For how many milliseconds without a change should changes be collected before acting on them?"`
+	Debounce         string            `toml:"debounce" yaml:"debounce" json:"debounce" comment:"When should changes be acted on? trailing once quiet, leading at once and once quiet"`
+	EventMaxWait     int               `toml:"event_max_wait" yaml:"event_max_wait" json:"event_max_wait" comment:"For how many milliseconds at most should changes be collected, 0 for no limit?"`
+	BulkThreshold    int               `toml:"bulk_threshold" yaml:"bulk_threshold" json:"bulk_threshold" comment:"From how many changes on are they a bulk change, like a branch switch, 0 to disable?"`
+	SettleTime       int               `toml:"settle_time" yaml:"settle_time" json:"settle_time" comment:"For how many milliseconds without a change should bulk changes and git operations settle before acting on them?"`
+	CacheSize        int               `toml:"cache_size" yaml:"cache_size" json:"cache_size" comment:"How many builds should be kept to be reused when the sources return to their state, 0 to disable?"`
+	Restart          string            `toml:"restart" yaml:"restart" json:"restart" comment:"How should the binary be restarted? stop_first before building or start_first once the new one is ready"`
+	ReadyCheck       string            `toml:"ready_check" yaml:"ready_check" json:"ready_check" comment:"Which http(s) URL or tcp address tells that the new binary is ready, notify to wait for READY=1 on NOTIFY_SOCKET or empty once started?"`
+	ReadyTimeout     int               `toml:"ready_timeout" yaml:"ready_timeout" json:"ready_timeout" comment:"For how many milliseconds at most should the new binary get to be ready?"`
+	KillDelay        int               `toml:"kill_delay" yaml:"kill_delay" json:"kill_delay" comment:"For how many milliseconds should the binary get to shut down gracefully?"`
+	Port             int               `toml:"port" yaml:"port" json:"port" comment:"The port used for the browser syncing server"`
 }
 
 type FilterConfiguration struct {
-	IncludeExts  []string `toml:"include_exts"`
-	ExcludeDirs  []string `toml:"exclude_relative_dirs"`
-	IncludeDirs  []string `toml:"include_relative_dirs"`
-	ExcludeFiles []string `toml:"exclude_relative_files"`
+	IncludeExts  []string `toml:"include_exts" yaml:"include_exts" json:"include_exts" comment:"Watch these extensions for changes"`
+	ExcludeDirs  []string `toml:"exclude_relative_dirs" yaml:"exclude_relative_dirs" json:"exclude_relative_dirs" comment:"Ignore these directories"`
+	IncludeDirs  []string `toml:"include_relative_dirs" yaml:"include_relative_dirs" json:"include_relative_dirs" comment:"Watch these directories for changes"`
+	ExcludeFiles []string `toml:"exclude_relative_files" yaml:"exclude_relative_files" json:"exclude_relative_files" comment:"Ignore these files"`
 }
 
-// Configuration is a in-memory representation of the expected configuration file
+type TestingConfiguration struct {
+	Flags       []string `toml:"flags" yaml:"flags" json:"flags" comment:"Which flags should be passed to go test?"`
+	ReverseDeps bool     `toml:"reverse_dependencies" yaml:"reverse_dependencies" json:"reverse_dependencies" comment:"Should the packages depending on the changed ones be tested as well?"`
+}
+
+type DebuggingConfiguration struct {
+	Delve string `toml:"delve" yaml:"delve" json:"delve" comment:"Which delve executable should the binary be debugged with?"`
+	Port  int    `toml:"port" yaml:"port" json:"port" comment:"Which port should delve accept debugging clients on?"`
+}
+
+type ListenConfiguration struct {
+	Address string `toml:"address" yaml:"address" json:"address" comment:"Which tcp address should gomon listen on and pass to the binary through socket activation, empty to disable?"`
+}
+
+type MonitorConfiguration struct {
+	Interval       int  `toml:"interval" yaml:"interval" json:"interval" comment:"Every how many milliseconds should the resources of the binary be sampled, 0 to disable?"`
+	MaxMemory      int  `toml:"max_memory" yaml:"max_memory" json:"max_memory" comment:"How many megabytes of memory may the binary use, 0 for no limit?"`
+	MaxCPUTime     int  `toml:"max_cpu_time" yaml:"max_cpu_time" json:"max_cpu_time" comment:"How many seconds of cpu time may the binary use, 0 for no limit?"`
+	MaxOpenFiles   int  `toml:"max_open_files" yaml:"max_open_files" json:"max_open_files" comment:"How many files may the binary have open, 0 for no limit?"`
+	DelegateCgroup bool `toml:"delegate_cgroup" yaml:"delegate_cgroup" json:"delegate_cgroup" comment:"Is the cgroup v2 gomon is started in delegated to it, so that it may enforce max_memory with a cgroup?"`
+}
+
+// The modes lint findings are treated with
+const (
+	// LintGate keeps the binary running instead of restarting it while there are findings
+	LintGate = "gate"
+	// LintAdvisory reports the findings after restarting the binary
+	LintAdvisory = "advisory"
+)
+
+// LintModes are the modes a lint configuration may select
+var LintModes = []string{LintGate, LintAdvisory}
+
+type LintConfiguration struct {
+	Commands []string `toml:"commands" yaml:"commands" json:"commands" comment:"Which lint commands should be run on change, e.g. go vet ./...?"`
+	Mode     string   `toml:"mode" yaml:"mode" json:"mode" comment:"Should findings block the restart? gate or advisory"`
+}
+
+// The modes debouncing changes
+const (
+	// DebounceTrailing acts on the changes of a burst once it is quiet
+	DebounceTrailing = "trailing"
+	// DebounceLeading acts on the first change of a burst at once and on the rest once it is quiet
+	DebounceLeading = "leading"
+)
+
+// DebounceModes are the modes a build configuration may select
+var DebounceModes = []string{DebounceTrailing, DebounceLeading}
+
+// The modes restarting the binary
+const (
+	// RestartStopFirst stops the binary before building the new one
+	RestartStopFirst = "stop_first"
+	// RestartStartFirst keeps the binary running while building and stops it once the new one is ready
+	RestartStartFirst = "start_first"
+)
+
+// RestartModes are the modes a build configuration may select
+var RestartModes = []string{RestartStopFirst, RestartStartFirst}
+
+// ReadyCheckNotify is the ready check waiting for the binary to send READY=1 to the socket in NOTIFY_SOCKET,
+// like systemd's sd_notify. Unlike an address, only the binary just started can pass it.
+const ReadyCheckNotify = "notify"
+
+// The backends watching for changes
+const (
+	// WatchAuto uses WatchNotify unless its events do not arrive, then WatchPoll
+	WatchAuto = "auto"
+	// WatchNotify is notified by the operating system, e.g. with inotify
+	WatchNotify = "notify"
+	// WatchPoll compares the files at an interval, e.g. for network and virtual machine mounts
+	WatchPoll = "poll"
+)
+
+// WatchBackends are the backends a watch configuration may select
+var WatchBackends = []string{WatchAuto, WatchNotify, WatchPoll}
+
+type WatchConfiguration struct {
+	Backend       string   `toml:"backend" yaml:"backend" json:"backend" comment:"How should changes be watched? auto, notify or poll"`
+	PollInterval  int      `toml:"poll_interval" yaml:"poll_interval" json:"poll_interval" comment:"Every how many milliseconds should the files be polled?"`
+	ChecksumCache bool     `toml:"checksum_cache" yaml:"checksum_cache" json:"checksum_cache" comment:"Should the file checksums be kept between runs to speed up the startup?"`
+	Roots         []string `toml:"roots" yaml:"roots" json:"roots" comment:"Which directories outside the root should be watched as well, absolute or relative to the root?"`
+	Modules       bool     `toml:"modules" yaml:"modules" json:"modules" comment:"Should the local modules used by go.work and replace directives be watched as well?"`
+}
+
+// ProfileConfiguration overrides the build when selected, keys that are not set keep the value of the build
+type ProfileConfiguration struct {
+	Command string            `toml:"build_command" yaml:"build_command" json:"build_command" comment:"How should the build be done?"`
+	Flags   []string          `toml:"build_flags" yaml:"build_flags" json:"build_flags" comment:"Which flags should be passed to the build command?"`
+	Env     map[string]string `toml:"env" yaml:"env" json:"env" comment:"Which environment variables should be added for the build and the binary?"`
+}
+
+// Configuration is a in-memory representation of the expected configuration file.
+// The same keys are used for every supported format.
 type Configuration struct {
-	Root   string
-	Reload bool
-	Sync   bool
-	Build  *BuildConfiguration  `toml:"build"`
-	Log    *LogConfiguration    `toml:"log"`
-	Color  *ColorConfiguration  `toml:"color"`
-	Filter *FilterConfiguration `toml:"filter"`
+	// Path is the absolute path of the configuration file in use, empty if none
+	Path string `toml:"-" yaml:"-" json:"-"`
+	// Layers are the absolute paths of the configuration files decoded, in order
+	Layers []string `toml:"-" yaml:"-" json:"-"`
+	// Profile is the name of the selected profile, empty if none
+	Profile string `toml:"-" yaml:"-" json:"-"`
+
+	Root   string               `toml:"root" yaml:"root" json:"root" comment:"The project root, defaults to the current directory"`
+	Reload bool                 `toml:"reload" yaml:"reload" json:"reload" comment:"Should the binary be rebuilt and restarted on change?"`
+	Sync   bool                 `toml:"sync" yaml:"sync" json:"sync" comment:"Should the browser be refreshed on change?"`
+	Test   bool                 `toml:"test" yaml:"test" json:"test" comment:"Should the tests of the changed packages be run on change?"`
+	Debug  bool                 `toml:"debug" yaml:"debug" json:"debug" comment:"Should the binary be built for and run under the delve debugger?"`
+	Build  *BuildConfiguration  `toml:"build" yaml:"build" json:"build"`
+	Log    *LogConfiguration    `toml:"log" yaml:"log" json:"log"`
+	Color  *ColorConfiguration  `toml:"color" yaml:"color" json:"color"`
+	Filter *FilterConfiguration `toml:"filter" yaml:"filter" json:"filter"`
+	Watch  *WatchConfiguration  `toml:"watch" yaml:"watch" json:"watch"`
+	// Testing is the go test configuration, the key test enables it
+	Testing *TestingConfiguration `toml:"testing" yaml:"testing" json:"testing"`
+	// Debugging is the delve configuration, the key debug enables it
+	Debugging *DebuggingConfiguration `toml:"debugging" yaml:"debugging" json:"debugging"`
+	Lint      *LintConfiguration      `toml:"lint" yaml:"lint" json:"lint"`
+	Listen    *ListenConfiguration    `toml:"listen" yaml:"listen" json:"listen"`
+	Monitor   *MonitorConfiguration   `toml:"monitor" yaml:"monitor" json:"monitor"`
+
+	Profiles map[string]*ProfileConfiguration `toml:"profile" yaml:"profile" json:"profile" comment:"Named build overrides selected with --profile"`
 }
 
 // DefaultConfiguration is the default configuration if none is provided
@@ -74,15 +213,31 @@ func DefaultConfiguration() *Configuration {
 		Root:   root,
 		Reload: true,
 		Sync:   true,
+		Test:   false,
+		Debug:  false,
 		Build: &BuildConfiguration{
 			Name:             "main",
 			RelDir:           "tmp/build",
 			RelSrcDir:        "",
 			EventBufferTime:  100,
+			Debounce:         DebounceTrailing,
+			EventMaxWait:     0,
+			BulkThreshold:    100,
+			SettleTime:       1000,
+			CacheSize:        5,
+			Restart:          RestartStopFirst,
+			ReadyCheck:       "",
+			ReadyTimeout:     5000,
 			KillDelay:        100,
 			ExecutionCommand: "",
+			ExecutionArgs:    []string{},
+			Shell:            false,
+			Args:             []string{},
 			Port:             3000,
 			Command:          "go build -o",
+			Flags:            []string{},
+			Tags:             []string{},
+			Env:              map[string]string{},
 		},
 		Log: &LogConfiguration{
 			BuildLog:       "gomon.log",
@@ -93,6 +248,8 @@ func DefaultConfiguration() *Configuration {
 			Run:            false,
 			Sync:           false,
 			App:            true,
+			Test:           true,
+			Status:         true,
 			Time:           true,
 		},
 		Color: &ColorConfiguration{
@@ -102,6 +259,8 @@ func DefaultConfiguration() *Configuration {
 			Run:       "green",
 			Sync:      "cyan",
 			App:       "blue",
+			Test:      "white",
+			Status:    "cyan",
 		},
 		Filter: &FilterConfiguration{
 			IncludeExts:  []string{"go", "tpl", "tmpl", "html", "css", "js", "env", "yaml"},
@@ -109,6 +268,35 @@ func DefaultConfiguration() *Configuration {
 			IncludeDirs:  []string{},
 			ExcludeFiles: []string{},
 		},
+		Watch: &WatchConfiguration{
+			Backend:       WatchAuto,
+			PollInterval:  500,
+			ChecksumCache: false,
+			Roots:         []string{},
+			Modules:       false,
+		},
+		Testing: &TestingConfiguration{
+			Flags:       []string{},
+			ReverseDeps: true,
+		},
+		Debugging: &DebuggingConfiguration{
+			Delve: "dlv",
+			Port:  2345,
+		},
+		Lint: &LintConfiguration{
+			Commands: []string{},
+			Mode:     LintAdvisory,
+		},
+		Listen: &ListenConfiguration{
+			Address: "",
+		},
+		Monitor: &MonitorConfiguration{
+			Interval:       0,
+			MaxMemory:      0,
+			MaxCPUTime:     0,
+			MaxOpenFiles:   0,
+			DelegateCgroup: false,
+		},
 	}
 }
 
@@ -135,14 +323,103 @@ func (c *Configuration) Colors() map[string]*color.Color {
 		"Detection": utils.Color(c.Color.Detection),
 		"Sync":      utils.Color(c.Color.Sync),
 		"App":       utils.Color(c.Color.App),
+		"Test":      utils.Color(c.Color.Test),
+		"Status":    utils.Color(c.Color.Status),
 	}
 }
 
+// Environment is the environment of the build and the binary
+func (c *Configuration) Environment() []string {
+	keys := make([]string, 0, len(c.Build.Env))
+	for key := range c.Build.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := os.Environ()
+	for _, key := range keys {
+		env = append(env, key+"="+c.Build.Env[key])
+	}
+	return env
+}
+
 // BufferTime is the event buffer time in milliseconds
 func (c *Configuration) BufferTime() time.Duration {
 	return time.Duration(c.Build.EventBufferTime) * time.Millisecond
 }
 
+// Debounce is how changes are grouped before acting on them
+func (c *Configuration) Debounce() utils.Debounce {
+	return utils.Debounce{
+		Quiet:         c.BufferTime(),
+		Leading:       c.Build.Debounce == DebounceLeading,
+		MaxWait:       time.Duration(c.Build.EventMaxWait) * time.Millisecond,
+		BulkThreshold: c.Build.BulkThreshold,
+		Settle:        c.SettleTime(),
+	}
+}
+
+// SettleTime is the time in milliseconds bulk changes and git operations have to settle
+func (c *Configuration) SettleTime() time.Duration {
+	return time.Duration(c.Build.SettleTime) * time.Millisecond
+}
+
+// ReadyTimeout is how long the new binary may take to be ready before it is given up on
+func (c *Configuration) ReadyTimeout() time.Duration {
+	return time.Duration(c.Build.ReadyTimeout) * time.Millisecond
+}
+
+// PollInterval is the interval in milliseconds the files are compared at when polling
+func (c *Configuration) PollInterval() time.Duration {
+	return time.Duration(c.Watch.PollInterval) * time.Millisecond
+}
+
+// limitInterval is how often the limits are checked when the resources are not sampled otherwise
+const limitInterval = time.Second
+
+// IsMonitored checks if the resources of the binary are sampled or limited
+func (c *Configuration) IsMonitored() bool {
+	return c.Monitor.Interval > 0 || c.HasLimits()
+}
+
+// HasLimits checks if any limit is set on the resources of the binary
+func (c *Configuration) HasLimits() bool {
+	return c.Monitor.MaxMemory > 0 || c.Monitor.MaxCPUTime > 0 || c.Monitor.MaxOpenFiles > 0
+}
+
+// MonitorInterval is the interval in milliseconds the resources of the binary are sampled at,
+// the limits are checked every second if they are not sampled otherwise
+func (c *Configuration) MonitorInterval() time.Duration {
+	if c.Monitor.Interval == 0 {
+		return limitInterval
+	}
+	return time.Duration(c.Monitor.Interval) * time.Millisecond
+}
+
+// WatchRoots are the absolute directories watched besides the root, the local modules included if enabled
+func (c *Configuration) WatchRoots() ([]string, error) {
+	roots := make([]string, 0, len(c.Watch.Roots))
+	for _, root := range c.Watch.Roots {
+		roots = append(roots, c.absPath(root))
+	}
+	if c.Watch.Modules {
+		modules, err := utils.LocalModules(c.Root)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, modules...)
+	}
+	return roots, nil
+}
+
+// absPath is the absolute representation of the path provided, relative paths are relative to the root
+func (c *Configuration) absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.Root, path)
+}
+
 // SrcDir is the current absolute source directory path
 func (c *Configuration) SrcDir() (string, error) {
 	return utils.CurrentAbsolutePath(c.Build.RelSrcDir)
@@ -163,6 +440,16 @@ func (c *Configuration) Binary() (string, error) {
 	return utils.CurrentAbsolutePath(filepath.Join(c.Build.RelDir, c.Build.Name))
 }
 
+// ChecksumCachePath is the current absolute path the file checksums are kept at between runs
+func (c *Configuration) ChecksumCachePath() (string, error) {
+	return utils.CurrentAbsolutePath(filepath.Join(c.Build.RelDir, "checksums.json"))
+}
+
+// BuildCacheDir is the current absolute path the builds are kept at to be reused
+func (c *Configuration) BuildCacheDir() (string, error) {
+	return utils.CurrentAbsolutePath(filepath.Join(c.Build.RelDir, "cache"))
+}
+
 // Log is the current absolute log path
 func (c *Configuration) BuildLog() (string, error) {
 	return utils.CurrentAbsolutePath(filepath.Join(c.Log.RelBuildLogDir, c.Log.BuildLog))
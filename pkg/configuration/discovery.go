@@ -0,0 +1,52 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Names are the configuration file names looked up during discovery, in order of precedence
+var Names = []string{
+	"gomon.toml", "gomon.yaml", "gomon.yml", "gomon.json",
+	".gomon.toml", ".gomon.yaml", ".gomon.yml", ".gomon.json",
+}
+
+const moduleFile = "go.mod"
+
+// Discover walks up from the directory provided and returns the path of the first configuration file found.
+// The walk ends at the module root, the directory containing the go.mod, since the configuration belongs next to it.
+func Discover(dir string) (string, error) {
+	for {
+		for _, name := range Names {
+			path := filepath.Join(dir, name)
+			isFile, err := isFile(path)
+			if err != nil {
+				return "", err
+			}
+			if isFile {
+				return path, nil
+			}
+		}
+
+		isModuleRoot, err := isFile(filepath.Join(dir, moduleFile))
+		if err != nil {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if isModuleRoot || parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func isFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
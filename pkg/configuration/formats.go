@@ -0,0 +1,147 @@
+package configuration
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// schemaKey may be used in YAML and JSON configuration files to point editors to the JSON Schema
+const schemaKey = "$schema"
+
+// Format is the configuration format derived from the file extension of the path provided, TOML if unknown
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatTOML
+	}
+}
+
+// node is a format independent view of a configuration document used to locate its keys
+type node struct {
+	line     int
+	column   int
+	keys     []string
+	children map[string]*node
+	items    []*node
+}
+
+func newNode(line int, column int) *node {
+	return &node{line: line, column: column, children: make(map[string]*node)}
+}
+
+func (n *node) add(key string, child *node) {
+	n.keys = append(n.keys, key)
+	n.children[key] = child
+}
+
+// lookup is the node at the dotted key path provided, nil if it is not part of the document
+func (n *node) lookup(key string) *node {
+	for _, k := range strings.Split(key, ".") {
+		if n == nil {
+			return nil
+		}
+		n = n.children[k]
+	}
+	return n
+}
+
+// decode decodes the configuration data of the format provided into the configuration
+func decode(cfgData []byte, format string, cfg *Configuration) (*node, error) {
+	switch format {
+	case FormatYAML:
+		return decodeYAML(cfgData, cfg)
+	case FormatJSON:
+		return decodeJSON(cfgData, cfg)
+	default:
+		return decodeTOML(cfgData, cfg)
+	}
+}
+
+func decodeTOML(cfgData []byte, cfg *Configuration) (*node, error) {
+	doc, err := toml.LoadBytes(cfgData)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Unmarshal(cfg); err != nil {
+		return nil, err
+	}
+	return tomlNode(doc), nil
+}
+
+func decodeYAML(cfgData []byte, cfg *Configuration) (*node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(cfgData, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return newNode(0, 0), nil
+	}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, err
+	}
+	return yamlNode(doc.Content[0]), nil
+}
+
+func decodeJSON(cfgData []byte, cfg *Configuration) (*node, error) {
+	if err := json.Unmarshal(cfgData, cfg); err != nil {
+		return nil, err
+	}
+	// JSON is YAML as well, which provides the positions the JSON decoder does not
+	var doc yaml.Node
+	if err := yaml.Unmarshal(cfgData, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return yamlNode(doc.Content[0]), nil
+}
+
+func tomlNode(doc *toml.Tree) *node {
+	pos := doc.Position()
+	n := newNode(pos.Line, pos.Col)
+	for _, key := range doc.Keys() {
+		pos := doc.GetPosition(key)
+		child := newNode(pos.Line, pos.Col)
+		switch value := doc.Get(key).(type) {
+		case *toml.Tree:
+			child = tomlNode(value)
+			child.line, child.column = pos.Line, pos.Col
+		case []*toml.Tree:
+			for _, item := range value {
+				child.items = append(child.items, tomlNode(item))
+			}
+		}
+		n.add(key, child)
+	}
+	return n
+}
+
+func yamlNode(doc *yaml.Node) *node {
+	n := newNode(doc.Line, doc.Column)
+	switch doc.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			key, value := doc.Content[i], doc.Content[i+1]
+			child := yamlNode(value)
+			child.line, child.column = key.Line, key.Column
+			n.add(key.Value, child)
+		}
+	case yaml.SequenceNode:
+		for _, item := range doc.Content {
+			n.items = append(n.items, yamlNode(item))
+		}
+	}
+	return n
+}
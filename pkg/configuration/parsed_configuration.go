@@ -1,17 +1,34 @@
 package configuration
 
 import (
+	"fmt"
+	"path/filepath"
 	"runtime"
 	"strings"
 
 	"github.com/AlexanderBrese/gomon/pkg/utils"
-	"github.com/imdario/mergo"
-	"github.com/pelletier/go-toml"
 )
 
-// ParsedConfiguration is a parsed configuration merged with the default configuration and adapted to the OS
+// ParsedConfiguration is a parsed configuration decoded over the default configuration and adapted to the OS.
+// Without a path the configuration file is discovered by walking up from the current root.
 func ParsedConfiguration(path string) (*Configuration, error) {
+	return ParsedProfileConfiguration(path, "")
+}
+
+// ParsedProfileConfiguration is a parsed configuration with its local configuration layered over it
+// and the profile provided applied, if any
+func ParsedProfileConfiguration(path string, profile string) (*Configuration, error) {
 	if path == "" {
+		var err error
+		if path, err = Discover(root); err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		if profile != "" {
+			return nil, fmt.Errorf("profile %q requires a configuration file", profile)
+		}
 		cfg := DefaultConfiguration()
 		if err := adapt(cfg); err != nil {
 			return nil, err
@@ -20,14 +37,16 @@ func ParsedConfiguration(path string) (*Configuration, error) {
 	} else if err := utils.CheckPath(path); err != nil {
 		return nil, err
 	} else {
-		cfg, err := parse(path)
+		cfg, docs, err := parse(path)
 		if err != nil {
 			return nil, err
 		}
-		err = merge(cfg)
-		if err != nil {
+		cfg.Path = path
+		cfg.Profile = profile
+		if err := validate(cfg, docs); err != nil {
 			return nil, err
 		}
+		applyProfile(cfg)
 		if err := adapt(cfg); err != nil {
 			return nil, err
 		}
@@ -35,32 +54,55 @@ func ParsedConfiguration(path string) (*Configuration, error) {
 	}
 }
 
-func parse(path string) (cfg *Configuration, err error) {
-	cfgData, err := utils.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	cfg, err = unmarshal(cfgData)
-	if err != nil {
-		return nil, err
-	}
-	err = validate(cfg)
-	if err != nil {
-		return nil, err
-	}
-	return cfg, err
+// LocalPath is the path of the local configuration layered over the configuration at the path provided,
+// e.g. gomon.local.toml for gomon.toml. It is meant to be ignored by version control.
+func LocalPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".local" + ext
 }
 
-func validate(cfg *Configuration) error {
-	absPath, err := utils.CurrentAbsolutePath(cfg.Build.RelSrcDir)
-	if err != nil {
-		return err
+// parse decodes the configuration at the path provided and its local configuration, if present, over the defaults
+func parse(path string) (*Configuration, []*document, error) {
+	cfg := DefaultConfiguration()
+	docs := make([]*document, 0, 2)
+	for _, layer := range []string{path, LocalPath(path)} {
+		if layer != path && utils.CheckPath(layer) != nil {
+			continue
+		}
+		cfgData, err := utils.ReadFile(layer)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc, err := decode(cfgData, Format(layer), cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", filepath.Base(layer), err)
+		}
+		cfg.Layers = append(cfg.Layers, layer)
+		docs = append(docs, &document{path: layer, root: doc})
 	}
-	return utils.CheckPath(absPath)
+	return cfg, docs, nil
 }
 
-func merge(cfg *Configuration) error {
-	return mergo.Merge(cfg, DefaultConfiguration())
+// applyProfile overrides the build with the keys set in the selected profile
+func applyProfile(cfg *Configuration) {
+	p, ok := cfg.Profiles[cfg.Profile]
+	if !ok {
+		return
+	}
+	if p.Command != "" {
+		cfg.Build.Command = p.Command
+	}
+	if p.Flags != nil {
+		cfg.Build.Flags = p.Flags
+	}
+	env := make(map[string]string, len(cfg.Build.Env)+len(p.Env))
+	for key, value := range cfg.Build.Env {
+		env[key] = value
+	}
+	for key, value := range p.Env {
+		env[key] = value
+	}
+	cfg.Build.Env = env
 }
 
 // Adapt to OS
@@ -71,6 +113,9 @@ func adapt(cfg *Configuration) error {
 			cfg.Build.Name += extName
 		}
 	}
+	if cfg.Build.ExecutionCommand != "" {
+		return nil
+	}
 	binary, err := cfg.Binary()
 	if err != nil {
 		return err
@@ -78,11 +123,3 @@ func adapt(cfg *Configuration) error {
 	cfg.Build.ExecutionCommand = binary
 	return nil
 }
-
-func unmarshal(cfgData []byte) (*Configuration, error) {
-	cfg := new(Configuration)
-	if err := toml.Unmarshal(cfgData, cfg); err != nil {
-		return nil, err
-	}
-	return cfg, nil
-}
@@ -1,6 +1,10 @@
 package configuration
 
 import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/AlexanderBrese/gomon/pkg/utils"
@@ -66,7 +70,9 @@ func TestConfigMerge(t *testing.T) {
 	port := 4000
 	testCfg := &Configuration{
 		Build: &BuildConfiguration{
-			Port: port,
+			Port:     port,
+			Debounce: DebounceTrailing,
+			Restart:  RestartStopFirst,
 		},
 	}
 	testCfgData, err := toml.Marshal(testCfg)
@@ -97,3 +103,432 @@ func TestConfigMerge(t *testing.T) {
 		t.Errorf("want: %q, got: %q", port, cfg.Build.Port)
 	}
 }
+
+func TestConfigDiscovery(t *testing.T) {
+	dir := "discovery"
+	absDir, err := utils.CurrentAbsolutePath(dir)
+	if err != nil {
+		t.Error(err)
+	}
+	nestedDir := filepath.Join(absDir, "nested", "deeper")
+	if err := utils.CreateAllDir(nestedDir); err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		if err := utils.RemoveAllDir(absDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	path := filepath.Join(absDir, ".gomon.toml")
+	if _, err := utils.CreateFile(path, []byte("[build]\nport = 4000\n")); err != nil {
+		t.Error(err)
+	}
+
+	discovered, err := Discover(nestedDir)
+	if err != nil {
+		t.Error(err)
+	}
+	if discovered != path {
+		t.Errorf("want: %q, got: %q", path, discovered)
+	}
+
+	cfg, err := ParsedConfiguration(discovered)
+	if err != nil {
+		t.Error(err)
+	}
+	if cfg.Path != path {
+		t.Errorf("want: %q, got: %q", path, cfg.Path)
+	}
+}
+
+func TestValidationProblems(t *testing.T) {
+	cfgData := "[build]\nkill_delay = -1\neventbuffertime = 100\n[color]\nmain = \"magneta\"\n[filter]\ninclude_relative_dirs = [\"nowhere\"]\ninclude_exts = []\n[watch]\nbackend = \"pol\"\n"
+	absPath, err := utils.CurrentAbsolutePath("test.toml")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := utils.CreateFile(absPath, []byte(cfgData)); err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		if err := utils.RemoveAllDir(absPath); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	_, err = ParsedConfiguration(absPath)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("want: validation error, got: %v", err)
+	}
+
+	want := map[string]Problem{
+		"build.kill_delay":             {Line: 2},
+		"build.eventbuffertime":        {Line: 3, Suggestion: "event_buffer_time"},
+		"color.main":                   {Line: 5, Suggestion: "magenta"},
+		"filter.include_relative_dirs": {Line: 7},
+		"filter.include_exts":          {Line: 8},
+		"watch.backend":                {Line: 10, Suggestion: "poll"},
+	}
+	if len(verr.Problems) != len(want) {
+		t.Errorf("want: %d problems, got: %q", len(want), verr.Problems)
+	}
+	for _, p := range verr.Problems {
+		w, ok := want[p.Key]
+		if !ok {
+			t.Errorf("want: no problem for %s, got: %s", p.Key, p)
+			continue
+		}
+		if p.Line != w.Line || p.Suggestion != w.Suggestion {
+			t.Errorf("want: line %d and suggestion %q for %s, got: %s", w.Line, w.Suggestion, p.Key, p)
+		}
+	}
+}
+
+func TestValidationProblemsInOrder(t *testing.T) {
+	cfgData := "[monitor]\ninterval = -1\nmax_memory = -1\nmax_cpu_time = -1\nmax_open_files = -1\n"
+	absPath, err := utils.CurrentAbsolutePath("test.toml")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := utils.CreateFile(absPath, []byte(cfgData)); err != nil {
+		t.Error(err)
+	}
+	defer func() {
+		if err := utils.RemoveAllDir(absPath); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	_, err = ParsedConfiguration(absPath)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("want: validation error, got: %v", err)
+	}
+	want := []string{"monitor.interval", "monitor.max_memory", "monitor.max_cpu_time", "monitor.max_open_files"}
+	var got []string
+	for _, p := range verr.Problems {
+		got = append(got, p.Key)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
+func TestHasDebugGcflags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"go", "build", "-gcflags=all=-N -l", "."}, true},
+		{[]string{"go", "build", "-gcflags=all=-l -N", "."}, true},
+		{[]string{"go", "build", "-gcflags", "all=-N -l", "."}, true},
+		{[]string{"go", "build", "--gcflags=-N -l", "."}, true},
+		{[]string{"go", "build", "-gcflags=-N -lfoo", "."}, false},
+		{[]string{"go", "build", "-gcflags=all=-N", "."}, false},
+		{[]string{"go", "build", "-ldflags=-N -l", "."}, false},
+		{[]string{"go", "build", "-gcflags"}, false},
+	}
+	for _, tt := range tests {
+		if got := hasDebugGcflags(tt.args); got != tt.want {
+			t.Errorf("%q: want: %t, got: %t", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestConflictingFields(t *testing.T) {
+	tests := []struct {
+		cfgData string
+		key     string
+		line    int
+	}{
+		{"[build]\nrestart = \"start_first\"\nready_check = \"http://localhost:8080/health\"\n[listen]\naddress = \":8080\"\n", "build.ready_check", 3},
+		{"debug = true\n[build]\nbuild_command = \"make build\"\n", "build.build_command", 3},
+		{"debug = true\n[build]\nbuild_command = \"go build -o {{.Binary}} {{.SrcDir}}\"\n", "build.build_command", 3},
+		{"debug = true\n[build]\nbuild_args = [\"go\", \"build\", \"-o\", \"{{.Binary}}\"]\n", "build.build_args", 3},
+		{"debug = true\n[build]\nbuild_args = [\"go\", \"build\", \"-gcflags=-N -lfoo\", \"-o\", \"{{.Binary}}\"]\n", "build.build_args", 3},
+		{"debug = true\n[build]\nbuild_command = \"make build # -N -l\"\n", "build.build_command", 3},
+		{"debug = true\nsync = true\n[build]\nport = 4000\n[debugging]\nport = 4000\n", "debugging.port", 6},
+		{"sync = true\n[build]\nport = 4000\n[listen]\naddress = \"localhost:4000\"\n", "listen.address", 5},
+		{"debug = true\n[listen]\naddress = \":2345\"\n", "listen.address", 3},
+	}
+	absPath, err := utils.CurrentAbsolutePath("test.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		if _, err := utils.CreateFile(absPath, []byte(tt.cfgData)); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ParsedConfiguration(absPath)
+		// the file is not truncated when it is created again
+		if err := utils.RemoveAllDir(absPath); err != nil {
+			t.Error(err)
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok || len(verr.Problems) != 1 {
+			t.Errorf("want: one validation problem for %q, got: %v", tt.cfgData, err)
+			continue
+		}
+		if p := verr.Problems[0]; p.Key != tt.key || p.Line != tt.line || p.Path != absPath {
+			t.Errorf("want: %s at %s:%d, got: %s", tt.key, absPath, tt.line, p)
+		}
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	formats := map[string]string{
+		"test.yaml": "build:\n  port: 4000\ncolor:\n  main: magneta\n",
+		"test.json": "{\n  \"build\": {\n    \"port\": 4000\n  },\n  \"color\": {\n    \"main\": \"magneta\"\n  }\n}\n",
+	}
+	wantLines := map[string]int{"test.yaml": 4, "test.json": 6}
+
+	for name, cfgData := range formats {
+		absPath, err := utils.CurrentAbsolutePath(name)
+		if err != nil {
+			t.Error(err)
+		}
+		if _, err := utils.CreateFile(absPath, []byte(cfgData)); err != nil {
+			t.Error(err)
+		}
+		defer func() {
+			if err := utils.RemoveAllDir(absPath); err != nil {
+				t.Error(err)
+			}
+		}()
+
+		_, err = ParsedConfiguration(absPath)
+		verr, ok := err.(*ValidationError)
+		if !ok || len(verr.Problems) != 1 {
+			t.Fatalf("want: one validation problem for %s, got: %v", name, err)
+		}
+		if p := verr.Problems[0]; p.Key != "color.main" || p.Line != wantLines[name] {
+			t.Errorf("want: color.main at line %d for %s, got: %s", wantLines[name], name, p)
+		}
+
+		fixed := strings.Replace(cfgData, "magneta", "magenta", 1)
+		if _, err := utils.CreateFile(absPath, []byte(fixed)); err != nil {
+			t.Error(err)
+		}
+		cfg, err := ParsedConfiguration(absPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Build.Port != 4000 || cfg.Color.Main != "magenta" {
+			t.Errorf("want: port 4000 and color magenta for %s, got: %d and %s", name, cfg.Build.Port, cfg.Color.Main)
+		}
+	}
+}
+
+func TestJSONSchemaIsPublished(t *testing.T) {
+	schema, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	published, err := utils.ReadFile(filepath.Join("..", "..", "docs", "gomon.schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(published)) != string(schema) {
+		t.Error("want: docs/gomon.schema.json to be up to date, regenerate it with gomon --print-schema")
+	}
+}
+
+func TestConfigFieldsOverrideDefaults(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+		got   func(*Configuration) interface{}
+		want  interface{}
+	}{
+		{"root", `"/tmp"`, func(c *Configuration) interface{} { return c.Root }, "/tmp"},
+		{"reload", "false", func(c *Configuration) interface{} { return c.Reload }, false},
+		{"sync", "false", func(c *Configuration) interface{} { return c.Sync }, false},
+		{"test", "true", func(c *Configuration) interface{} { return c.Test }, true},
+		{"debug", "true", func(c *Configuration) interface{} { return c.Debug }, true},
+		{"build.build_name", `"app"`, func(c *Configuration) interface{} { return c.Build.Name }, "app"},
+		{"build.relative_build_dir", `"out"`, func(c *Configuration) interface{} { return c.Build.RelDir }, "out"},
+		{"build.relative_source_dir", `"."`, func(c *Configuration) interface{} { return c.Build.RelSrcDir }, "."},
+		{"build.execution_args", `["{{.Binary}}", "serve"]`, func(c *Configuration) interface{} { return c.Build.ExecutionArgs }, []string{"{{.Binary}}", "serve"}},
+		{"build.shell", "true", func(c *Configuration) interface{} { return c.Build.Shell }, true},
+		{"build.build_args", `["make", "BIN={{.Binary}}"]`, func(c *Configuration) interface{} { return c.Build.Args }, []string{"make", "BIN={{.Binary}}"}},
+		{"build.execution_command", `"./app serve"`, func(c *Configuration) interface{} { return c.Build.ExecutionCommand }, "./app serve"},
+		{"build.build_command", `"go build -race -o"`, func(c *Configuration) interface{} { return c.Build.Command }, "go build -race -o"},
+		{"build.event_buffer_time", "0", func(c *Configuration) interface{} { return c.Build.EventBufferTime }, 0},
+		{"build.debounce", `"leading"`, func(c *Configuration) interface{} { return c.Build.Debounce }, "leading"},
+		{"build.event_max_wait", "1000", func(c *Configuration) interface{} { return c.Build.EventMaxWait }, 1000},
+		{"build.bulk_threshold", "0", func(c *Configuration) interface{} { return c.Build.BulkThreshold }, 0},
+		{"build.settle_time", "500", func(c *Configuration) interface{} { return c.Build.SettleTime }, 500},
+		{"build.tags", `["integration"]`, func(c *Configuration) interface{} { return c.Build.Tags }, []string{"integration"}},
+		{"build.ldflags", `"-s -w"`, func(c *Configuration) interface{} { return c.Build.Ldflags }, "-s -w"},
+		{"build.gcflags", `"all=-N -l"`, func(c *Configuration) interface{} { return c.Build.Gcflags }, "all=-N -l"},
+		{"build.race", "true", func(c *Configuration) interface{} { return c.Build.Race }, true},
+		{"build.trimpath", "true", func(c *Configuration) interface{} { return c.Build.Trimpath }, true},
+		{"build.cgo_enabled", `"0"`, func(c *Configuration) interface{} { return c.Build.CgoEnabled }, "0"},
+		{"build.goos", `"linux"`, func(c *Configuration) interface{} { return c.Build.Goos }, "linux"},
+		{"build.goarch", `"arm64"`, func(c *Configuration) interface{} { return c.Build.Goarch }, "arm64"},
+		{"build.cache_size", "0", func(c *Configuration) interface{} { return c.Build.CacheSize }, 0},
+		{"build.restart", `"start_first"`, func(c *Configuration) interface{} { return c.Build.Restart }, "start_first"},
+		{"build.ready_check", `"localhost:8080"`, func(c *Configuration) interface{} { return c.Build.ReadyCheck }, "localhost:8080"},
+		{"build.ready_timeout", "1000", func(c *Configuration) interface{} { return c.Build.ReadyTimeout }, 1000},
+		{"build.kill_delay", "0", func(c *Configuration) interface{} { return c.Build.KillDelay }, 0},
+		{"build.port", "4000", func(c *Configuration) interface{} { return c.Build.Port }, 4000},
+		{"build.build_flags", `["-race"]`, func(c *Configuration) interface{} { return c.Build.Flags }, []string{"-race"}},
+		{"build.env", `{ GOFLAGS = "-mod=mod" }`, func(c *Configuration) interface{} { return c.Build.Env }, map[string]string{"GOFLAGS": "-mod=mod"}},
+		{"log.build_log_name", `"build.log"`, func(c *Configuration) interface{} { return c.Log.BuildLog }, "build.log"},
+		{"log.relative_build_log_dir", `"logs"`, func(c *Configuration) interface{} { return c.Log.RelBuildLogDir }, "logs"},
+		{"log.time", "false", func(c *Configuration) interface{} { return c.Log.Time }, false},
+		{"log.main", "false", func(c *Configuration) interface{} { return c.Log.Main }, false},
+		{"log.detection", "true", func(c *Configuration) interface{} { return c.Log.Detection }, true},
+		{"log.build", "false", func(c *Configuration) interface{} { return c.Log.Build }, false},
+		{"log.run", "true", func(c *Configuration) interface{} { return c.Log.Run }, true},
+		{"log.sync", "true", func(c *Configuration) interface{} { return c.Log.Sync }, true},
+		{"log.app", "false", func(c *Configuration) interface{} { return c.Log.App }, false},
+		{"log.test", "false", func(c *Configuration) interface{} { return c.Log.Test }, false},
+		{"log.status", "false", func(c *Configuration) interface{} { return c.Log.Status }, false},
+		{"color.main", `"white"`, func(c *Configuration) interface{} { return c.Color.Main }, "white"},
+		{"color.detection", `"white"`, func(c *Configuration) interface{} { return c.Color.Detection }, "white"},
+		{"color.build", `"white"`, func(c *Configuration) interface{} { return c.Color.Build }, "white"},
+		{"color.run", `"white"`, func(c *Configuration) interface{} { return c.Color.Run }, "white"},
+		{"color.sync", `"white"`, func(c *Configuration) interface{} { return c.Color.Sync }, "white"},
+		{"color.app", `"white"`, func(c *Configuration) interface{} { return c.Color.App }, "white"},
+		{"color.test", `"red"`, func(c *Configuration) interface{} { return c.Color.Test }, "red"},
+		{"color.status", `"white"`, func(c *Configuration) interface{} { return c.Color.Status }, "white"},
+		{"filter.include_exts", `["templ"]`, func(c *Configuration) interface{} { return c.Filter.IncludeExts }, []string{"templ"}},
+		{"filter.exclude_relative_dirs", "[]", func(c *Configuration) interface{} { return c.Filter.ExcludeDirs }, []string{}},
+		{"filter.include_relative_dirs", `["."]`, func(c *Configuration) interface{} { return c.Filter.IncludeDirs }, []string{"."}},
+		{"filter.exclude_relative_files", `["main.go"]`, func(c *Configuration) interface{} { return c.Filter.ExcludeFiles }, []string{"main.go"}},
+		{"watch.backend", `"poll"`, func(c *Configuration) interface{} { return c.Watch.Backend }, "poll"},
+		{"watch.poll_interval", "1000", func(c *Configuration) interface{} { return c.Watch.PollInterval }, 1000},
+		{"watch.checksum_cache", "true", func(c *Configuration) interface{} { return c.Watch.ChecksumCache }, true},
+		{"watch.roots", `[".."]`, func(c *Configuration) interface{} { return c.Watch.Roots }, []string{".."}},
+		{"watch.modules", "true", func(c *Configuration) interface{} { return c.Watch.Modules }, true},
+		{"testing.flags", `["-race"]`, func(c *Configuration) interface{} { return c.Testing.Flags }, []string{"-race"}},
+		{"testing.reverse_dependencies", "false", func(c *Configuration) interface{} { return c.Testing.ReverseDeps }, false},
+		{"lint.commands", `["go vet ./..."]`, func(c *Configuration) interface{} { return c.Lint.Commands }, []string{"go vet ./..."}},
+		{"debugging.delve", `"/go/bin/dlv"`, func(c *Configuration) interface{} { return c.Debugging.Delve }, "/go/bin/dlv"},
+		{"debugging.port", "40000", func(c *Configuration) interface{} { return c.Debugging.Port }, 40000},
+		{"lint.mode", `"gate"`, func(c *Configuration) interface{} { return c.Lint.Mode }, "gate"},
+		{"listen.address", `":8080"`, func(c *Configuration) interface{} { return c.Listen.Address }, ":8080"},
+		{"monitor.interval", "2000", func(c *Configuration) interface{} { return c.Monitor.Interval }, 2000},
+		{"monitor.max_memory", "512", func(c *Configuration) interface{} { return c.Monitor.MaxMemory }, 512},
+		{"monitor.max_cpu_time", "60", func(c *Configuration) interface{} { return c.Monitor.MaxCPUTime }, 60},
+		{"monitor.max_open_files", "1024", func(c *Configuration) interface{} { return c.Monitor.MaxOpenFiles }, 1024},
+		{"monitor.delegate_cgroup", "true", func(c *Configuration) interface{} { return c.Monitor.DelegateCgroup }, true},
+		{"profile", `{ race = { build_flags = ["-race"] } }`, func(c *Configuration) interface{} { return c.Profiles["race"] }, &ProfileConfiguration{Flags: []string{"-race"}}},
+	}
+
+	if fields := leafKeys(reflect.TypeOf(Configuration{})); len(fields) != len(tests) {
+		t.Fatalf("want: a test for each of the %d configuration keys, got: %d", len(fields), len(tests))
+	}
+
+	absPath, err := utils.CurrentAbsolutePath("test.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := utils.RemoveAllDir(absPath); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			defaults := DefaultConfiguration()
+			if reflect.DeepEqual(tt.got(defaults), tt.want) {
+				t.Fatalf("want: a value different from the default for %s, got: %v", tt.key, tt.want)
+			}
+
+			cfgData := fmt.Sprintf("%s = %s\n", tt.key, tt.value)
+			if i := strings.Index(tt.key, "."); i != -1 {
+				cfgData = fmt.Sprintf("[%s]\n%s = %s\n", tt.key[:i], tt.key[i+1:], tt.value)
+			}
+			if err := utils.RemoveAllDir(absPath); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := utils.CreateFile(absPath, []byte(cfgData)); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := ParsedConfiguration(absPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.got(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want: %v, got: %v", tt.want, got)
+			}
+			if cfg.Build.Name != defaults.Build.Name && tt.key != "build.build_name" {
+				t.Errorf("want: other keys to keep their defaults, got: build name %q", cfg.Build.Name)
+			}
+		})
+	}
+}
+
+func leafKeys(t reflect.Type) []string {
+	var keys []string
+	for name, field := range keyFields(t) {
+		if field.Kind() == reflect.Ptr && field.Elem().Kind() == reflect.Struct {
+			for _, key := range leafKeys(field.Elem()) {
+				keys = append(keys, name+"."+key)
+			}
+			continue
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+func TestConfigProfilesAndLocalLayer(t *testing.T) {
+	sharedData := "[build]\nport = 4000\nbuild_flags = [\"-v\"]\nenv = { A = \"shared\" }\n[profile.race]\nbuild_flags = [\"-race\"]\nenv = { B = \"race\" }\n"
+	localData := "[build]\nport = 5000\n"
+	sharedPath, err := utils.CurrentAbsolutePath("test.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localPath := LocalPath(sharedPath)
+	if localPath != filepath.Join(filepath.Dir(sharedPath), "test.local.toml") {
+		t.Errorf("want: test.local.toml, got: %s", localPath)
+	}
+	for path, data := range map[string]string{sharedPath: sharedData, localPath: localData} {
+		if _, err := utils.CreateFile(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		defer func(path string) {
+			if err := utils.RemoveAllDir(path); err != nil {
+				t.Error(err)
+			}
+		}(path)
+	}
+
+	cfg, err := ParsedProfileConfiguration(sharedPath, "race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Build.Port != 5000 {
+		t.Errorf("want: local port 5000, got: %d", cfg.Build.Port)
+	}
+	if !reflect.DeepEqual(cfg.Build.Flags, []string{"-race"}) {
+		t.Errorf("want: profile flags [-race], got: %v", cfg.Build.Flags)
+	}
+	if want := map[string]string{"A": "shared", "B": "race"}; !reflect.DeepEqual(cfg.Build.Env, want) {
+		t.Errorf("want: env %v, got: %v", want, cfg.Build.Env)
+	}
+	if !reflect.DeepEqual(cfg.Layers, []string{sharedPath, localPath}) {
+		t.Errorf("want: both layers, got: %v", cfg.Layers)
+	}
+
+	_, err = ParsedProfileConfiguration(sharedPath, "rase")
+	if verr, ok := err.(*ValidationError); !ok || verr.Problems[0].Suggestion != "race" {
+		t.Errorf("want: unknown profile suggesting race, got: %v", err)
+	}
+
+	if _, err := utils.CreateFile(localPath, []byte("[build]\nprot = 5000\n")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParsedConfiguration(sharedPath)
+	if verr, ok := err.(*ValidationError); !ok || verr.Problems[0].Path != localPath {
+		t.Errorf("want: unknown key in %s, got: %v", localPath, err)
+	}
+}
@@ -0,0 +1,99 @@
+package configuration
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema describes the configuration for editors to autocomplete and validate it
+func JSONSchema() ([]byte, error) {
+	defaults := DefaultConfiguration()
+	// the root defaults to the current directory which is different for everyone
+	defaults.Root = ""
+
+	schema := objectSchema(reflect.ValueOf(defaults).Elem())
+	schema["$schema"] = schemaDraft
+	schema["title"] = "gomon configuration"
+	schema["properties"].(map[string]interface{})[schemaKey] = map[string]interface{}{
+		"type":        "string",
+		"description": "The JSON Schema of this file",
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func objectSchema(defaults reflect.Value) map[string]interface{} {
+	t := defaults.Type()
+	properties := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := keyName(f)
+		if name == "-" {
+			continue
+		}
+		property := valueSchema(defaults.Field(i))
+		if description := f.Tag.Get("comment"); description != "" {
+			property["description"] = description
+		}
+		if t == reflect.TypeOf(ColorConfiguration{}) {
+			property["enum"] = utils.ColorNames()
+		}
+		if t == reflect.TypeOf(WatchConfiguration{}) && name == "backend" {
+			property["enum"] = WatchBackends
+		}
+		if t == reflect.TypeOf(BuildConfiguration{}) && name == "debounce" {
+			property["enum"] = DebounceModes
+		}
+		if t == reflect.TypeOf(BuildConfiguration{}) && name == "restart" {
+			property["enum"] = RestartModes
+		}
+		if t == reflect.TypeOf(LintConfiguration{}) && name == "mode" {
+			property["enum"] = LintModes
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func valueSchema(defaults reflect.Value) map[string]interface{} {
+	switch defaults.Kind() {
+	case reflect.Ptr:
+		if defaults.IsNil() {
+			return objectSchema(reflect.New(defaults.Type().Elem()).Elem())
+		}
+		return objectSchema(defaults.Elem())
+	case reflect.Struct:
+		return objectSchema(defaults)
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": valueSchema(reflect.New(defaults.Type().Elem()).Elem()),
+		}
+	case reflect.Slice:
+		schema := map[string]interface{}{
+			"type":  "array",
+			"items": valueSchema(reflect.New(defaults.Type().Elem()).Elem()),
+		}
+		if !defaults.IsNil() {
+			schema["default"] = defaults.Interface()
+		}
+		return schema
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean", "default": defaults.Bool()}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer", "minimum": 0, "default": defaults.Int()}
+	default:
+		schema := map[string]interface{}{"type": "string"}
+		if defaults.String() != "" {
+			schema["default"] = defaults.String()
+		}
+		return schema
+	}
+}
@@ -0,0 +1,605 @@
+package configuration
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+const maxPort = 65535
+
+// Problem is a single issue found in a configuration
+type Problem struct {
+	// Path is the configuration file the problem was found in, empty if it is not caused by a file
+	Path       string
+	Key        string
+	Line       int
+	Column     int
+	Message    string
+	Suggestion string
+}
+
+func (p Problem) String() string {
+	msg := p.Message
+	if p.Key != "" {
+		msg = fmt.Sprintf("%s: %s", p.Key, msg)
+	}
+	if p.Line > 0 {
+		msg = fmt.Sprintf("%d:%d: %s", p.Line, p.Column, msg)
+	}
+	if p.Path != "" && p.Line > 0 {
+		msg = fmt.Sprintf("%s:%s", p.Path, msg)
+	} else if p.Path != "" {
+		msg = fmt.Sprintf("%s: %s", p.Path, msg)
+	}
+	if p.Suggestion != "" {
+		msg = fmt.Sprintf("%s, did you mean %q?", msg, p.Suggestion)
+	}
+	return msg
+}
+
+// ValidationError collects every problem found in a configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// CheckConfiguration reports every problem of the configuration at the path provided with the profile provided,
+// including those that only show up at runtime such as a port already in use
+func CheckConfiguration(path string, profile string) ([]Problem, error) {
+	cfg, err := ParsedProfileConfiguration(path, profile)
+	if verr, ok := err.(*ValidationError); ok {
+		return verr.Problems, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []*document
+	if cfg.Path != "" {
+		if _, docs, err = parse(cfg.Path); err != nil {
+			return nil, err
+		}
+	}
+	return checkAvailability(cfg, docs), nil
+}
+
+// document is a decoded configuration file
+type document struct {
+	path string
+	root *node
+}
+
+type validation struct {
+	docs     []*document
+	problems []Problem
+}
+
+func validate(cfg *Configuration, docs []*document) error {
+	v := &validation{docs: docs}
+	for _, doc := range docs {
+		v.checkKeys(doc, doc.root, reflect.TypeOf(Configuration{}), nil)
+	}
+	v.checkProfile(cfg)
+	v.checkColors(cfg.Color)
+	v.checkBuild(cfg.Build)
+	v.checkFilter(cfg.Filter)
+	v.checkWatch(cfg.Watch)
+	v.checkRoots(cfg)
+	v.checkDebugging(cfg.Debugging)
+	v.checkLint(cfg.Lint)
+	v.checkListen(cfg.Listen)
+	v.checkMonitor(cfg.Monitor)
+	v.checkRestart(cfg)
+	v.checkDebug(cfg)
+	v.checkPorts(cfg)
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// report adds a problem located in the last document setting the key, or the first document if none does
+func (v *validation) report(key string, suggestion string, format string, a ...interface{}) {
+	p := Problem{
+		Key:        key,
+		Message:    fmt.Sprintf(format, a...),
+		Suggestion: suggestion,
+	}
+	if len(v.docs) > 0 {
+		p.Path = v.docs[0].path
+	}
+	for i := len(v.docs) - 1; i >= 0 && key != ""; i-- {
+		if n := v.docs[i].root.lookup(key); n != nil {
+			p.Path, p.Line, p.Column = v.docs[i].path, n.line, n.column
+			break
+		}
+	}
+	v.problems = append(v.problems, p)
+}
+
+// reportAt adds a problem located in the document provided
+func (v *validation) reportAt(doc *document, key string, suggestion string, format string, a ...interface{}) {
+	p := Problem{
+		Path:       doc.path,
+		Key:        key,
+		Message:    fmt.Sprintf(format, a...),
+		Suggestion: suggestion,
+	}
+	if n := doc.root.lookup(key); n != nil {
+		p.Line, p.Column = n.line, n.column
+	}
+	v.problems = append(v.problems, p)
+}
+
+// checkKeys reports keys of the document that do not map to a field of the type provided
+func (v *validation) checkKeys(doc *document, n *node, t reflect.Type, path []string) {
+	fields := keyFields(t)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, key := range n.keys {
+		if len(path) == 0 && key == schemaKey {
+			continue
+		}
+		keyPath := append(append([]string{}, path...), key)
+		field, ok := fields[key]
+		if !ok {
+			v.reportAt(doc, strings.Join(keyPath, "."), closest(key, names), "unknown key")
+			continue
+		}
+		v.checkValue(doc, n.children[key], field, keyPath)
+	}
+}
+
+func (v *validation) checkValue(doc *document, n *node, t reflect.Type, path []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		v.checkKeys(doc, n, t, path)
+	case reflect.Map:
+		for _, key := range n.keys {
+			v.checkValue(doc, n.children[key], t.Elem(), append(append([]string{}, path...), key))
+		}
+	case reflect.Slice:
+		for _, item := range n.items {
+			v.checkValue(doc, item, t.Elem(), path)
+		}
+	}
+}
+
+func (v *validation) checkProfile(cfg *Configuration) {
+	if cfg.Profile == "" {
+		return
+	}
+	if _, ok := cfg.Profiles[cfg.Profile]; ok {
+		return
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	v.report("", closest(cfg.Profile, names), "unknown profile %q, expected one of [%s]", cfg.Profile, strings.Join(names, ", "))
+}
+
+func (v *validation) checkColors(c *ColorConfiguration) {
+	rv := reflect.ValueOf(c).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := rv.Field(i).String()
+		if utils.IsColor(name) {
+			continue
+		}
+		key := "color." + keyName(rt.Field(i))
+		v.report(key, closest(name, utils.ColorNames()), "unknown color %q, expected one of %s", name, strings.Join(utils.ColorNames(), ", "))
+	}
+}
+
+func (v *validation) checkBuild(b *BuildConfiguration) {
+	if b.EventBufferTime < 0 {
+		v.report("build.event_buffer_time", "", "must not be negative, got %d", b.EventBufferTime)
+	}
+	if !contains(DebounceModes, b.Debounce) {
+		v.report("build.debounce", closest(b.Debounce, DebounceModes), "unknown mode %q, expected one of %s", b.Debounce, strings.Join(DebounceModes, ", "))
+	}
+	if b.EventMaxWait < 0 {
+		v.report("build.event_max_wait", "", "must not be negative, got %d", b.EventMaxWait)
+	}
+	if b.BulkThreshold < 0 {
+		v.report("build.bulk_threshold", "", "must not be negative, got %d", b.BulkThreshold)
+	}
+	if b.SettleTime < 0 {
+		v.report("build.settle_time", "", "must not be negative, got %d", b.SettleTime)
+	}
+	if b.CacheSize < 0 {
+		v.report("build.cache_size", "", "must not be negative, got %d", b.CacheSize)
+	}
+	if err := checkCommand(b.Command); err != nil {
+		v.report("build.build_command", "", "%s", err)
+	}
+	if err := checkCommand(b.ExecutionCommand); err != nil {
+		v.report("build.execution_command", "", "%s", err)
+	}
+	for _, arg := range b.Args {
+		if err := checkTemplate(arg); err != nil {
+			v.report("build.build_args", "", "%s", err)
+		}
+	}
+	for _, arg := range b.ExecutionArgs {
+		if err := checkTemplate(arg); err != nil {
+			v.report("build.execution_args", "", "%s", err)
+		}
+	}
+	for _, flag := range b.Flags {
+		if _, err := utils.SplitArgs(flag); err != nil {
+			v.report("build.build_flags", "", "%s", err)
+		}
+	}
+	if !contains(cgoModes, b.CgoEnabled) {
+		v.report("build.cgo_enabled", "", "expected 1, 0 or empty, got %q", b.CgoEnabled)
+	}
+	if !contains(RestartModes, b.Restart) {
+		v.report("build.restart", closest(b.Restart, RestartModes), "unknown mode %q, expected one of %s", b.Restart, strings.Join(RestartModes, ", "))
+	}
+	if err := checkReadyCheck(b.ReadyCheck); err != nil {
+		v.report("build.ready_check", "", "%s", err)
+	}
+	if b.ReadyTimeout < 0 {
+		v.report("build.ready_timeout", "", "must not be negative, got %d", b.ReadyTimeout)
+	}
+	if b.KillDelay < 0 {
+		v.report("build.kill_delay", "", "must not be negative, got %d", b.KillDelay)
+	}
+	if b.Port < 1 || b.Port > maxPort {
+		v.report("build.port", "", "must be between 1 and %d, got %d", maxPort, b.Port)
+	}
+	if err := checkRelDir(b.RelSrcDir); err != nil {
+		v.report("build.relative_source_dir", "", "%s", err)
+	}
+}
+
+// cgoModes are the values cgo_enabled may be set to, empty leaves it to go build
+var cgoModes = []string{"", "0", "1"}
+
+// checkCommand checks that the command can be split into arguments and that its placeholders parse
+func checkCommand(command string) error {
+	if _, err := utils.SplitArgs(command); err != nil {
+		return err
+	}
+	return checkTemplate(command)
+}
+
+func checkTemplate(s string) error {
+	_, err := template.New("").Parse(s)
+	return err
+}
+
+// checkReadyCheck checks that the ready check is an http(s) URL, a tcp address or notify
+func checkReadyCheck(check string) error {
+	if check == "" {
+		return nil
+	}
+	if check == ReadyCheckNotify {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("%s is not supported on windows", ReadyCheckNotify)
+		}
+		return nil
+	}
+	addr := check
+	if strings.Contains(check, "://") {
+		u, err := url.Parse(check)
+		if err != nil {
+			return err
+		}
+		switch u.Scheme {
+		case "http", "https":
+			return nil
+		case "tcp":
+			addr = u.Host
+		default:
+			return fmt.Errorf("unknown scheme %q, expected http, https or tcp", u.Scheme)
+		}
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("expected host:port, got %q", addr)
+	}
+	return nil
+}
+
+func (v *validation) checkFilter(f *FilterConfiguration) {
+	// no file would ever be acted on
+	if len(f.IncludeExts) == 0 {
+		v.report("filter.include_exts", "", "%s", "must not be empty")
+	}
+	for _, dir := range f.IncludeDirs {
+		if err := checkRelDir(dir); err != nil {
+			v.report("filter.include_relative_dirs", "", "%s", err)
+		}
+	}
+}
+
+func (v *validation) checkWatch(w *WatchConfiguration) {
+	if !contains(WatchBackends, w.Backend) {
+		v.report("watch.backend", closest(w.Backend, WatchBackends), "unknown backend %q, expected one of %s", w.Backend, strings.Join(WatchBackends, ", "))
+	}
+	if w.PollInterval < 1 {
+		v.report("watch.poll_interval", "", "must be positive, got %d", w.PollInterval)
+	}
+}
+
+func (v *validation) checkDebugging(d *DebuggingConfiguration) {
+	if d.Delve == "" {
+		v.report("debugging.delve", "", "%s", "must not be empty")
+	}
+	if d.Port < 1 || d.Port > maxPort {
+		v.report("debugging.port", "", "must be between 1 and %d, got %d", maxPort, d.Port)
+	}
+}
+
+func (v *validation) checkLint(l *LintConfiguration) {
+	if !contains(LintModes, l.Mode) {
+		v.report("lint.mode", closest(l.Mode, LintModes), "unknown mode %q, expected one of %s", l.Mode, strings.Join(LintModes, ", "))
+	}
+}
+
+func (v *validation) checkListen(l *ListenConfiguration) {
+	if l.Address == "" {
+		return
+	}
+	if _, _, err := net.SplitHostPort(l.Address); err != nil {
+		v.report("listen.address", "", "expected host:port, got %q", l.Address)
+	}
+}
+
+// checkRestart checks that the ready check of the start_first mode can only be passed by the new binary.
+// The shared listener hands the connections of an address check to either binary, mostly the previous one.
+func (v *validation) checkRestart(cfg *Configuration) {
+	b := cfg.Build
+	if b.Restart != RestartStartFirst || cfg.Listen.Address == "" || b.ReadyCheck == "" || b.ReadyCheck == ReadyCheckNotify {
+		return
+	}
+	v.report("build.ready_check", ReadyCheckNotify, "is answered by the previous binary through the shared listener of listen.address, the new binary cannot be told apart")
+}
+
+// checkDebug checks that the binary is built for the debugger, the flags disabling optimizations and inlining
+// are only added to go build with the structured build options. Other commands have to pass them on their own.
+func (v *validation) checkDebug(cfg *Configuration) {
+	b := cfg.Build
+	if !cfg.Debug {
+		return
+	}
+	if len(b.Args) > 0 {
+		if !hasDebugGcflags(b.Args) {
+			v.report("build.build_args", "", "are not built for the debugger, pass -gcflags=\"all=-N -l\" to go build or use the build command")
+		}
+		return
+	}
+	args, err := utils.SplitArgs(b.Command)
+	if err == nil && len(args) >= 2 && args[0] == "go" && args[1] == "build" && !strings.Contains(b.Command, "{{") {
+		return
+	}
+	for _, flag := range b.Flags {
+		// a flag failing to split fails the build anyway
+		flagArgs, _ := utils.SplitArgs(flag)
+		args = append(args, flagArgs...)
+	}
+	if !hasDebugGcflags(args) {
+		v.report("build.build_command", "", "is not built for the debugger as it is no go build without placeholders, pass -gcflags=\"all=-N -l\" to go build")
+	}
+}
+
+// hasDebugGcflags checks if the arguments pass -gcflags disabling optimizations with -N and inlining with -l,
+// in any order and for any package pattern, e.g. -gcflags="all=-N -l" or -gcflags "-l -N"
+func hasDebugGcflags(args []string) bool {
+	for i, arg := range args {
+		var value string
+		switch {
+		case arg == "-gcflags" || arg == "--gcflags":
+			if i+1 == len(args) {
+				return false
+			}
+			value = args[i+1]
+		case strings.HasPrefix(arg, "-gcflags=") || strings.HasPrefix(arg, "--gcflags="):
+			value = arg[strings.Index(arg, "=")+1:]
+		default:
+			continue
+		}
+		// the flags may be preceded by the pattern of the packages they apply to
+		if pattern := strings.Index(value, "="); pattern >= 0 && !strings.HasPrefix(value, "-") {
+			value = value[pattern+1:]
+		}
+		flags, err := utils.SplitArgs(value)
+		if err != nil {
+			continue
+		}
+		if contains(flags, "-N") && contains(flags, "-l") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPorts checks that the ports gomon listens on in use do not collide, which would only fail at runtime.
+// Those are the port of the browser sync server, of delve and of the listener shared with the binary.
+func (v *validation) checkPorts(cfg *Configuration) {
+	if cfg.Debug && cfg.Sync && cfg.Debugging.Port == cfg.Build.Port {
+		v.report("debugging.port", "", "port %d is the browser sync port of build.port as well", cfg.Debugging.Port)
+	}
+	if cfg.Listen.Address == "" {
+		return
+	}
+	_, port, err := net.SplitHostPort(cfg.Listen.Address)
+	if err != nil {
+		return
+	}
+	if cfg.Sync && port == strconv.Itoa(cfg.Build.Port) {
+		v.report("listen.address", "", "port %s is the browser sync port of build.port as well", port)
+	}
+	if cfg.Debug && port == strconv.Itoa(cfg.Debugging.Port) {
+		v.report("listen.address", "", "port %s is the delve port of debugging.port as well", port)
+	}
+}
+
+func (v *validation) checkMonitor(m *MonitorConfiguration) {
+	for _, field := range []struct {
+		key   string
+		value int
+	}{
+		{"monitor.interval", m.Interval},
+		{"monitor.max_memory", m.MaxMemory},
+		{"monitor.max_cpu_time", m.MaxCPUTime},
+		{"monitor.max_open_files", m.MaxOpenFiles},
+	} {
+		if field.value < 0 {
+			v.report(field.key, "", "must not be negative, got %d", field.value)
+		}
+	}
+}
+
+func (v *validation) checkRoots(cfg *Configuration) {
+	for _, root := range cfg.Watch.Roots {
+		if err := checkDir(cfg.absPath(root), root); err != nil {
+			v.report("watch.roots", "", "%s", err)
+		}
+	}
+}
+
+// checkAvailability reports resources the configuration relies on that are taken by others
+func checkAvailability(cfg *Configuration, docs []*document) []Problem {
+	v := &validation{docs: docs}
+	if cfg.Sync {
+		v.checkAvailable("build.port", fmt.Sprintf(":%d", cfg.Build.Port), "the browser sync server")
+	}
+	if cfg.Debug {
+		v.checkAvailable("debugging.port", fmt.Sprintf("localhost:%d", cfg.Debugging.Port), "delve")
+	}
+	if cfg.Listen.Address != "" {
+		v.checkAvailable("listen.address", cfg.Listen.Address, "the listener of the binary")
+	}
+	return v.problems
+}
+
+// checkAvailable reports the address of the key unless it can be listened on
+func (v *validation) checkAvailable(key string, addr string, user string) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		v.report(key, "", "%s is not available for %s: %s", addr, user, err)
+		return
+	}
+	l.Close()
+}
+
+func checkRelDir(relDir string) error {
+	absDir, err := utils.CurrentAbsolutePath(relDir)
+	if err != nil {
+		return err
+	}
+	return checkDir(absDir, relDir)
+}
+
+// checkDir checks if there is a directory at the absolute path, reporting it as named
+func checkDir(absDir string, name string) error {
+	isDir, err := utils.IsDir(absDir)
+	if err != nil {
+		return fmt.Errorf("directory %q does not exist", name)
+	}
+	if !isDir {
+		return fmt.Errorf("%q is not a directory", name)
+	}
+	return nil
+}
+
+// keyFields maps the keys of the struct type provided to their field types
+func keyFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := keyName(t.Field(i))
+		if name == "-" {
+			continue
+		}
+		fields[name] = t.Field(i).Type
+	}
+	return fields
+}
+
+// keyName is the configuration key of the field provided, which is the same in every format
+func keyName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("toml"), ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// closest is the candidate most similar to the name provided, empty if none is similar enough
+func closest(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/2 + 1
+	for _, c := range candidates {
+		if d := distance(strings.ToLower(name), strings.ToLower(c)); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between a and b
+func distance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minimum(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minimum(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package event
+
+import (
+	"sync"
+)
+
+// subscriptionEvents is the number of events buffered per subscription before events are dropped
+const subscriptionEvents = 100
+
+// Bus fans published events out to any number of subscriptions without ever blocking the publisher.
+// Subscriptions drop the events they have no room for, pendings merge them. A nil Bus drops every event.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*Subscription]bool
+	pendings      map[*Pending]bool
+	closed        bool
+}
+
+// NewBus creates a new Bus
+func NewBus() *Bus {
+	return &Bus{subscriptions: make(map[*Subscription]bool), pendings: make(map[*Pending]bool)}
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	bus    *Bus
+	events chan Event
+}
+
+// Subscribe creates a new Subscription, which is closed right away if the Bus already is
+func (b *Bus) Subscribe() *Subscription {
+	s := &Subscription{bus: b, events: make(chan Event, subscriptionEvents)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.events)
+		return s
+	}
+	b.subscriptions[s] = true
+	return s
+}
+
+// Publish sends the event to every subscription with room for it and to every pending accepting it
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for p := range b.pendings {
+		p.put(ev)
+	}
+	for s := range b.subscriptions {
+		select {
+		case s.events <- ev:
+		default:
+		}
+	}
+}
+
+// Close closes every subscription and drops events published from now on
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for p := range b.pendings {
+		delete(b.pendings, p)
+		close(p.done)
+	}
+	for s := range b.subscriptions {
+		delete(b.subscriptions, s)
+		close(s.events)
+	}
+}
+
+// Events is the channel the events are received on, it is closed with the subscription
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes and closes the events channel
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if !s.bus.subscriptions[s] {
+		return
+	}
+	delete(s.bus.subscriptions, s)
+	close(s.events)
+}
@@ -0,0 +1,140 @@
+package event
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	early := bus.Subscribe()
+	bus.Publish(BuildStarted{At: time.Unix(1, 0)})
+	late := bus.Subscribe()
+	bus.Publish(BuildStarted{At: time.Unix(2, 0)})
+
+	for _, want := range []time.Time{time.Unix(1, 0), time.Unix(2, 0)} {
+		if ev := <-early.Events(); ev.Time() != want {
+			t.Errorf("want: %s, got: %s", want, ev.Time())
+		}
+	}
+	if ev := <-late.Events(); ev.Time() != time.Unix(2, 0) {
+		t.Errorf("want: only the event published after subscribing, got: %s", ev.Time())
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	s := bus.Subscribe()
+	s.Close()
+	s.Close()
+	bus.Publish(BuildStarted{})
+	if ev, ok := <-s.Events(); ok {
+		t.Errorf("want: the events closed, got: %v", ev)
+	}
+
+	bus.Close()
+	bus.Publish(BuildStarted{})
+	if ev, ok := <-bus.Subscribe().Events(); ok {
+		t.Errorf("want: the events of a closed bus closed, got: %v", ev)
+	}
+}
+
+func TestPublishDropsWhenFull(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	s := bus.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*subscriptionEvents; i++ {
+			bus.Publish(ResourcesSampled{At: time.Unix(int64(i), 0)})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want: publishing not blocked by a full subscription, got: blocked")
+	}
+	if n := len(s.Events()); n != subscriptionEvents {
+		t.Errorf("want: %d events, got: %d", subscriptionEvents, n)
+	}
+	if ev := <-s.Events(); ev.Time() != time.Unix(0, 0) {
+		t.Errorf("want: the events that had room kept, got: %s", ev.Time())
+	}
+}
+
+func TestPendingMerges(t *testing.T) {
+	bus := NewBus()
+	defer bus.Close()
+	isBuild := func(ev Event) bool {
+		_, ok := ev.(BuildFinished)
+		return ok
+	}
+	// the latest build is kept, unless an earlier one failed
+	p := bus.Pend(isBuild, func(pending Event, ev Event) Event {
+		if pending.(BuildFinished).Err != nil {
+			return pending
+		}
+		return ev
+	})
+	defer p.Close()
+
+	if ev := p.Take(); ev != nil {
+		t.Errorf("want: nothing pending, got: %v", ev)
+	}
+	failed := BuildFinished{At: time.Unix(1, 0), Err: errors.New("failed")}
+	bus.Publish(failed)
+	for i := 0; i < 2*subscriptionEvents; i++ {
+		bus.Publish(ResourcesSampled{})
+		bus.Publish(BuildFinished{At: time.Unix(2, 0)})
+	}
+	select {
+	case <-p.Ready():
+	default:
+		t.Fatal("want: ready, got: not ready")
+	}
+	if ev := p.Take(); !reflect.DeepEqual(ev, failed) {
+		t.Errorf("want: %v, got: %v", failed, ev)
+	}
+	if ev := p.Take(); ev != nil {
+		t.Errorf("want: nothing pending after taking, got: %v", ev)
+	}
+
+	p.Close()
+	bus.Publish(BuildFinished{})
+	select {
+	case <-p.Done():
+	default:
+		t.Error("want: done once closed, got: not done")
+	}
+	if ev := p.Take(); ev != nil {
+		t.Errorf("want: nothing received once closed, got: %v", ev)
+	}
+}
+
+func TestPendingAppendKeepsEveryEvent(t *testing.T) {
+	bus := NewBus()
+	p := bus.Pend(func(Event) bool { return true }, Append)
+	var want []Event
+	for i := 0; i < 2*subscriptionEvents; i++ {
+		ev := ResourcesSampled{At: time.Unix(int64(i), 0)}
+		bus.Publish(ev)
+		want = append(want, ev)
+	}
+	bus.Close()
+
+	select {
+	case <-p.Done():
+	default:
+		t.Error("want: done once the bus is closed, got: not done")
+	}
+	if got := Events(p.Take()); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %d events in order, got: %d", len(want), len(got))
+	}
+	if got := Events(p.Take()); got != nil {
+		t.Errorf("want: no events, got: %v", got)
+	}
+}
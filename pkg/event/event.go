@@ -0,0 +1,194 @@
+package event
+
+import (
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Event is something gomon observed or did
+type Event interface {
+	// Time is when the event occurred
+	Time() time.Time
+}
+
+// FilesChanged is published when the contents of watched files changed
+type FilesChanged struct {
+	At time.Time
+	// Paths are the absolute paths of the changed files
+	Paths []string
+	// Ops are the operations that changed the files, in the same order as the paths
+	Ops []fsnotify.Op
+	// Detected is when the first of the changes was detected, they are published later if they were held back
+	Detected time.Time
+}
+
+func (e FilesChanged) Time() time.Time { return e.At }
+
+// ConfigurationChanged is published when a valid edit of the configuration file in use was detected
+type ConfigurationChanged struct {
+	At            time.Time
+	Configuration *configuration.Configuration
+}
+
+func (e ConfigurationChanged) Time() time.Time { return e.At }
+
+// BuildStarted is published when the binary starts building
+type BuildStarted struct {
+	At time.Time
+}
+
+func (e BuildStarted) Time() time.Time { return e.At }
+
+// BuildFinished is published when the binary finished building, successfully if Err is nil
+type BuildFinished struct {
+	At       time.Time
+	Duration time.Duration
+	Err      error
+	Output   string
+	// Cached is set if a build of the same sources was reused instead
+	Cached bool
+}
+
+func (e BuildFinished) Time() time.Time { return e.At }
+
+// AppStarted is published when the binary was started, in the start_first restart mode once it was ready
+type AppStarted struct {
+	At     time.Time
+	Pid    int
+	Timing Timing
+}
+
+func (e AppStarted) Time() time.Time { return e.At }
+
+// AppExited is published when the binary exited, on its own or because it was stopped
+type AppExited struct {
+	At   time.Time
+	Pid  int
+	Code int
+}
+
+func (e AppExited) Time() time.Time { return e.At }
+
+// SyncSent is published when the browsers were told to refresh
+type SyncSent struct {
+	At      time.Time
+	Clients int
+	// Timing is the timing of the binary the browsers were refreshed for
+	Timing Timing
+}
+
+func (e SyncSent) Time() time.Time { return e.At }
+
+// Timing are the durations of the stages of a reload cycle, from detecting changes until the binary was ready
+type Timing struct {
+	// Detected is when the changes were detected, zero for the first build which follows no change
+	Detected time.Time
+	// Wait is from the detection until the build started, linting in the gate mode included
+	Wait  time.Duration
+	Build time.Duration
+	// Startup is from starting the binary until it was ready, or until it was spawned without a ready check
+	Startup time.Duration
+	// Ready tells that the startup lasted until the ready check passed, otherwise it is the time to spawn the binary
+	Ready bool
+}
+
+// CycleTimed is published once a reload cycle following changes completed, which is when the browsers
+// were refreshed, or when the binary was started without syncing
+type CycleTimed struct {
+	At     time.Time
+	Timing Timing
+	// Total is from the detection until the cycle completed
+	Total time.Duration
+}
+
+func (e CycleTimed) Time() time.Time { return e.At }
+
+// TestsStarted is published when go test started for the packages affected by changes
+type TestsStarted struct {
+	At time.Time
+	// Packages are the import paths of the packages tested
+	Packages []string
+}
+
+func (e TestsStarted) Time() time.Time { return e.At }
+
+// TestsFinished is published when go test finished, unless newer changes canceled it.
+// Err is set if the tests could not be run at all.
+type TestsFinished struct {
+	At       time.Time
+	Duration time.Duration
+	Packages []PackageResult
+	Failures []TestFailure
+	Err      error
+}
+
+func (e TestsFinished) Time() time.Time { return e.At }
+
+// PackageResult is the outcome of testing a package
+type PackageResult struct {
+	Package string
+	Passed  bool
+	Elapsed time.Duration
+}
+
+// TestFailure is a failed test, or a package failing to build if Test is empty
+type TestFailure struct {
+	Package string
+	Test    string
+	// Location is the file:line the failure was reported at, relative to the root, empty if unknown
+	Location string
+	Output   string
+}
+
+// LintFinished is published when the lint commands finished. Err is set if a command failed without findings,
+// Blocked if the findings kept the binary from restarting.
+type LintFinished struct {
+	At          time.Time
+	Duration    time.Duration
+	Diagnostics []Diagnostic
+	Err         error
+	Blocked     bool
+}
+
+func (e LintFinished) Time() time.Time { return e.At }
+
+// Diagnostic is a finding of a lint command at a file:line
+type Diagnostic struct {
+	Command string
+	File    string
+	Line    int
+	// Column is 0 if the command reports none
+	Column  int
+	Message string
+}
+
+// ResourcesSampled is published periodically with the resource usage of the running binary
+type ResourcesSampled struct {
+	At  time.Time
+	Pid int
+	// RSS is the resident memory in bytes
+	RSS uint64
+	// CPU is the share of a core used since the previous sample in percent, 0 for the first sample
+	CPU       float64
+	CPUTime   time.Duration
+	OpenFiles int
+}
+
+func (e ResourcesSampled) Time() time.Time { return e.At }
+
+// LimitExceeded is published when the binary reached a configured limit. Killed is set if it was stopped for it,
+// otherwise the operating system enforces the limit, e.g. by failing to open more files.
+type LimitExceeded struct {
+	At  time.Time
+	Pid int
+	// Limit is the key of the limit in the monitor configuration, like max_memory
+	Limit string
+	// Usage and Max are in bytes, seconds or files depending on the limit
+	Usage  uint64
+	Max    uint64
+	Killed bool
+}
+
+func (e LimitExceeded) Time() time.Time { return e.At }
@@ -0,0 +1,109 @@
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Pending receives the events it accepts without ever dropping one, unlike a Subscription. An event published
+// while another is pending is merged into it, so that a slow reader takes them all at once.
+type Pending struct {
+	bus     *Bus
+	accepts func(Event) bool
+	merge   func(pending Event, ev Event) Event
+
+	mu      sync.Mutex
+	pending Event
+	// ready holds a signal while an event may be pending
+	ready chan struct{}
+	// done is closed once no events are received anymore
+	done chan struct{}
+}
+
+// Pend creates a Pending receiving the events accepted from now on. Merge combines the event pending with
+// the one published, which are both accepted.
+func (b *Bus) Pend(accepts func(Event) bool, merge func(pending Event, ev Event) Event) *Pending {
+	p := &Pending{bus: b, accepts: accepts, merge: merge, ready: make(chan struct{}, 1), done: make(chan struct{})}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(p.done)
+		return p
+	}
+	b.pendings[p] = true
+	return p
+}
+
+// put merges the event into the one pending and signals it, without blocking
+func (p *Pending) put(ev Event) {
+	if !p.accepts(ev) {
+		return
+	}
+	p.mu.Lock()
+	if p.pending == nil {
+		p.pending = ev
+	} else {
+		p.pending = p.merge(p.pending, ev)
+	}
+	p.mu.Unlock()
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready receives a signal once an event may be pending, Take returns it
+func (p *Pending) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Done is closed once the Pending or the Bus is closed, an event may still be pending then
+func (p *Pending) Done() <-chan struct{} {
+	return p.done
+}
+
+// Take returns the event pending and clears it, nil if none is
+func (p *Pending) Take() Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ev := p.pending
+	p.pending = nil
+	return ev
+}
+
+// Close stops receiving events
+func (p *Pending) Close() {
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	if !p.bus.pendings[p] {
+		return
+	}
+	delete(p.bus.pendings, p)
+	close(p.done)
+}
+
+// Batch are events merged by Append in the order they were published
+type Batch []Event
+
+func (e Batch) Time() time.Time { return e[len(e)-1].Time() }
+
+// Append merges the events into a Batch, so that a Pending merging with it keeps every event it accepts
+func Append(pending Event, ev Event) Event {
+	batch, ok := pending.(Batch)
+	if !ok {
+		batch = Batch{pending}
+	}
+	return append(batch, ev)
+}
+
+// Events are the events of a Batch, or the event itself if it is no Batch
+func Events(ev Event) []Event {
+	switch ev := ev.(type) {
+	case nil:
+		return nil
+	case Batch:
+		return ev
+	default:
+		return []Event{ev}
+	}
+}
@@ -0,0 +1,111 @@
+// Package gomon is the API to embed gomon into other programs.
+//
+//	cfg, err := configuration.ParsedConfiguration("")
+//	if err != nil {
+//		return err
+//	}
+//	g, err := gomon.New(cfg, gomon.WithLogger(logging.NewLoggerWithOutput(cfg, w)))
+//	if err != nil {
+//		return err
+//	}
+//	go func() {
+//		for ev := range g.Subscribe() {
+//			// react to the event
+//		}
+//	}()
+//	return g.Run(ctx)
+package gomon
+
+import (
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/reload"
+	"github.com/AlexanderBrese/gomon/pkg/surveillance"
+)
+
+type (
+	// Gomon watches for changes, rebuilds and restarts the binary and syncs the browser
+	Gomon = surveillance.Gomon
+	// Option customizes Gomon
+	Option = surveillance.Option
+	// Timings collects the timings of the reload cycles of a session
+	Timings = surveillance.Timings
+	// Percentile are the durations of the stages of the reload cycles at a percentile
+	Percentile = surveillance.Percentile
+	// Event is published to subscribers of Gomon
+	Event = event.Event
+	// Bus fans the events out to its subscriptions
+	Bus = event.Bus
+	// FilesChanged is published when the contents of watched files changed
+	FilesChanged = event.FilesChanged
+	// ConfigurationChanged is published when a valid edit of the configuration file in use was detected
+	ConfigurationChanged = event.ConfigurationChanged
+	// BuildStarted is published when the binary starts building
+	BuildStarted = event.BuildStarted
+	// BuildFinished is published when the binary finished building
+	BuildFinished = event.BuildFinished
+	// AppStarted is published when the binary was started
+	AppStarted = event.AppStarted
+	// AppExited is published when the binary exited
+	AppExited = event.AppExited
+	// SyncSent is published when the browsers were told to refresh
+	SyncSent = event.SyncSent
+	// Timing are the durations of the stages of a reload cycle
+	Timing = event.Timing
+	// CycleTimed is published once a reload cycle following changes completed
+	CycleTimed = event.CycleTimed
+	// TestsStarted is published when go test started for the packages affected by changes
+	TestsStarted = event.TestsStarted
+	// TestsFinished is published when go test finished
+	TestsFinished = event.TestsFinished
+	// PackageResult is the outcome of testing a package
+	PackageResult = event.PackageResult
+	// TestFailure is a failed test, or a package failing to build
+	TestFailure = event.TestFailure
+	// LintFinished is published when the lint commands finished
+	LintFinished = event.LintFinished
+	// Diagnostic is a finding of a lint command
+	Diagnostic = event.Diagnostic
+	// ResourcesSampled is published periodically with the resource usage of the binary
+	ResourcesSampled = event.ResourcesSampled
+	// LimitExceeded is published when the binary reached a configured limit
+	LimitExceeded = event.LimitExceeded
+
+	// Builder builds the binary
+	Builder = reload.Builder
+	// Runner starts the built binary
+	Runner = reload.Runner
+	// Process is a binary started by a Runner
+	Process = reload.Process
+)
+
+// New creates a Gomon with the configuration and options provided
+func New(cfg *configuration.Configuration, opts ...Option) (*Gomon, error) {
+	return surveillance.New(cfg, opts...)
+}
+
+// WithLogger replaces the logger created from the configuration
+func WithLogger(l *logging.Logger) Option {
+	return surveillance.WithLogger(l)
+}
+
+// NewBus creates a Bus to share with WithEvents
+func NewBus() *Bus {
+	return event.NewBus()
+}
+
+// WithEvents publishes the events to the bus provided instead of one owned by Gomon
+func WithEvents(b *Bus) Option {
+	return surveillance.WithEvents(b)
+}
+
+// WithBuilder replaces the configured build command
+func WithBuilder(b Builder) Option {
+	return surveillance.WithBuilder(b)
+}
+
+// WithRunner replaces the configured execution command
+func WithRunner(r Runner) Option {
+	return surveillance.WithRunner(r)
+}
@@ -0,0 +1,14 @@
+package gotest
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killGroup makes canceling the command kill the test binaries go test started as well
+func killGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,14 @@
+package gotest
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killGroup makes canceling the command kill the test binaries go test started as well
+func killGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		// https://stackoverflow.com/a/44551450
+		return exec.Command("TASKKILL", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
@@ -0,0 +1,104 @@
+// Package gotest runs the tests of the packages affected by changes
+package gotest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// Tester runs go test for the packages affected by changed files
+type Tester struct {
+	config *configuration.Configuration
+	// Events receives the test events, they are dropped if nil
+	Events *event.Bus
+}
+
+func NewTester(cfg *configuration.Configuration) *Tester {
+	return &Tester{config: cfg}
+}
+
+// Run tests the packages affected by the changed files and publishes the outcome.
+// A run canceled by the context, e.g. because of newer changes, publishes nothing once canceled.
+func (t *Tester) Run(ctx context.Context, paths []string) {
+	start := time.Now()
+	pkgs, err := t.list(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		t.finish(start, nil, fmt.Errorf("during package listing: %w", err))
+		return
+	}
+	affected := Affected(pkgs, paths, t.config.Testing.ReverseDeps)
+	if len(affected) == 0 {
+		return
+	}
+
+	t.Events.Publish(event.TestsStarted{At: time.Now(), Packages: affected})
+	report, err := t.test(ctx, affected)
+	if ctx.Err() != nil {
+		return
+	}
+	if report != nil {
+		t.locate(report, pkgs)
+	}
+	t.finish(start, report, err)
+}
+
+func (t *Tester) finish(start time.Time, report *Report, err error) {
+	finished := event.TestsFinished{At: time.Now(), Duration: time.Since(start), Err: err}
+	if report != nil {
+		finished.Packages = report.Packages
+		finished.Failures = report.Failures
+	}
+	t.Events.Publish(finished)
+}
+
+// test runs go test -json for the packages provided, failing tests are no error
+func (t *Tester) test(ctx context.Context, pkgs []string) (*Report, error) {
+	args := append([]string{"test", "-json"}, t.config.Testing.Flags...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", append(args, pkgs...)...)
+	cmd.Dir = t.config.Root
+	cmd.Env = t.config.Environment()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	killGroup(cmd)
+
+	runErr := cmd.Run()
+	report, err := ParseReport(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("during test output parsing: %w", err)
+	}
+	if runErr != nil && len(report.Failures) == 0 {
+		return report, fmt.Errorf("during go test: %w: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	return report, nil
+}
+
+// locate makes the locations of the failures relative to the root, go test reports them relative to their package
+func (t *Tester) locate(report *Report, pkgs []Package) {
+	dirs := make(map[string]string, len(pkgs))
+	for _, pkg := range pkgs {
+		dirs[pkg.ImportPath] = pkg.Dir
+	}
+	for i, f := range report.Failures {
+		dir, ok := dirs[f.Package]
+		if f.Location == "" || !ok || filepath.IsAbs(f.Location) {
+			continue
+		}
+		rel, err := utils.RelPath(t.config.Root, filepath.Join(dir, filepath.Base(f.Location)))
+		if err == nil {
+			report.Failures[i].Location = rel
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package gotest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+)
+
+func TestTester(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod":      "module example.com/app\n\ngo 1.16\n",
+		"a/a.go":      "package a\n\nfunc Sum(x, y int) int { return x - y }\n",
+		"a/a_test.go": "package a\n\nimport \"testing\"\n\nfunc TestSum(t *testing.T) {\n\tif got := Sum(1, 2); got != 3 {\n\t\tt.Errorf(\"want: 3, got: %d\", got)\n\t}\n}\n",
+		"b/b.go":      "package b\n\nimport \"example.com/app/a\"\n\nvar Three = a.Sum(1, 2)\n",
+		"b/b_test.go": "package b\n\nimport \"testing\"\n\nfunc TestThree(t *testing.T) {}\n",
+		"c/c.go":      "package c\n",
+		"c/c_test.go": "package c\n\nimport \"testing\"\n\nfunc TestC(t *testing.T) {}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := configuration.DefaultConfiguration()
+	cfg.Root = root
+	tester := NewTester(cfg)
+	tester.Events = event.NewBus()
+	sub := tester.Events.Subscribe()
+	defer sub.Close()
+
+	tester.Run(context.Background(), []string{filepath.Join(root, "a", "a.go")})
+
+	started := (<-sub.Events()).(event.TestsStarted)
+	if len(started.Packages) != 2 {
+		t.Errorf("want: example.com/app/a and its dependent example.com/app/b tested, got: %v", started.Packages)
+	}
+	finished := (<-sub.Events()).(event.TestsFinished)
+	if finished.Err != nil {
+		t.Fatal(finished.Err)
+	}
+	if len(finished.Failures) != 1 {
+		t.Fatalf("want: TestSum failing, got: %+v", finished.Failures)
+	}
+	if f := finished.Failures[0]; f.Test != "TestSum" || f.Location != filepath.Join("a", "a_test.go:7") {
+		t.Errorf("want: TestSum failing at a/a_test.go:7, got: %+v", f)
+	}
+}
+
+func TestCanceledTester(t *testing.T) {
+	cfg := configuration.DefaultConfiguration()
+	cfg.Root = t.TempDir()
+	tester := NewTester(cfg)
+	tester.Events = event.NewBus()
+	sub := tester.Events.Subscribe()
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tester.Run(ctx, []string{filepath.Join(cfg.Root, "main.go")})
+	select {
+	case ev := <-sub.Events():
+		t.Errorf("want: a canceled run to publish nothing, got: %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
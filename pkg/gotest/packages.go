@@ -0,0 +1,93 @@
+package gotest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// Package is what go list tells about a package
+type Package struct {
+	ImportPath   string
+	Dir          string
+	Deps         []string
+	TestImports  []string
+	XTestImports []string
+}
+
+// dependsOn checks if the package or its tests depend on the package with the import path provided
+func (p Package) dependsOn(importPath string) bool {
+	for _, imports := range [][]string{p.Deps, p.TestImports, p.XTestImports} {
+		for _, i := range imports {
+			if i == importPath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// list are the packages of the module at the root
+func (t *Tester) list(ctx context.Context) ([]Package, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-json", "./...")
+	cmd.Dir = t.config.Root
+	cmd.Env = t.config.Environment()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var pkgs []Package
+	dec := json.NewDecoder(&stdout)
+	for {
+		var pkg Package
+		err := dec.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			return pkgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+// Affected are the import paths of the packages the changed files belong to, files of their testdata included.
+// With reverse set the packages depending on those are affected as well, by their tests too.
+func Affected(pkgs []Package, paths []string, reverse bool) []string {
+	changed := make(map[string]bool)
+	for _, path := range paths {
+		for _, pkg := range pkgs {
+			if filepath.Dir(path) == pkg.Dir || utils.IsBelow(filepath.Join(pkg.Dir, "testdata"), path) {
+				changed[pkg.ImportPath] = true
+			}
+		}
+	}
+
+	affected := make([]string, 0, len(changed))
+	for _, pkg := range pkgs {
+		isAffected := changed[pkg.ImportPath]
+		for importPath := range changed {
+			if isAffected || !reverse {
+				break
+			}
+			isAffected = pkg.dependsOn(importPath)
+		}
+		if isAffected {
+			affected = append(affected, pkg.ImportPath)
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
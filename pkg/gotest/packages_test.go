@@ -0,0 +1,35 @@
+package gotest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAffected(t *testing.T) {
+	pkgs := []Package{
+		{ImportPath: "example.com/app", Dir: "/app", Deps: []string{"example.com/app/a", "fmt"}},
+		{ImportPath: "example.com/app/a", Dir: "/app/a", Deps: []string{"fmt"}},
+		{ImportPath: "example.com/app/b", Dir: "/app/b", XTestImports: []string{"example.com/app/a"}},
+		{ImportPath: "example.com/app/c", Dir: "/app/c"},
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		reverse bool
+		want    []string
+	}{
+		{"package", []string{"/app/a/a.go"}, false, []string{"example.com/app/a"}},
+		{"reverse dependencies", []string{"/app/a/a.go"}, true, []string{"example.com/app", "example.com/app/a", "example.com/app/b"}},
+		{"testdata", []string{"/app/c/testdata/golden.txt"}, true, []string{"example.com/app/c"}},
+		{"no package", []string{"/app/docs/index.html"}, true, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Affected(pkgs, test.paths, test.reverse)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want: %v, got: %v", test.want, got)
+			}
+		})
+	}
+}
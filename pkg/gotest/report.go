@@ -0,0 +1,116 @@
+package gotest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/event"
+)
+
+// location matches the file:line a test reports at, or a compiler reports at
+var location = regexp.MustCompile(`([\w./\\-]+\.go:\d+)`)
+
+// testEvent is a line of go test -json output
+type testEvent struct {
+	Action     string
+	Package    string
+	Test       string
+	Elapsed    float64
+	Output     string
+	ImportPath string
+}
+
+// Report is the outcome of go test -json
+type Report struct {
+	Packages []event.PackageResult
+	Failures []event.TestFailure
+}
+
+// ParseReport reads the output of go test -json. Failing subtests are reported instead of their parents,
+// packages failing without a failed test are reported as failures of their own, e.g. if they did not build.
+func ParseReport(r io.Reader) (*Report, error) {
+	report := &Report{}
+	outputs := make(map[string][]string)
+	failed := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var ev testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// go test prints some build errors as plain text
+			continue
+		}
+		key := ev.Package + "\x00" + ev.Test
+		switch ev.Action {
+		case "output":
+			outputs[key] = append(outputs[key], ev.Output)
+		case "build-output":
+			pkg := strings.SplitN(ev.ImportPath, " ", 2)[0]
+			outputs[pkg+"\x00"] = append(outputs[pkg+"\x00"], ev.Output)
+		case "pass", "skip", "fail":
+			isFailed := ev.Action == "fail"
+			if ev.Test != "" {
+				if isFailed {
+					failed[ev.Package] = true
+					report.Failures = append(report.Failures, failure(ev.Package, ev.Test, outputs[key]))
+				}
+				continue
+			}
+			report.Packages = append(report.Packages, event.PackageResult{
+				Package: ev.Package,
+				Passed:  !isFailed,
+				Elapsed: time.Duration(ev.Elapsed * float64(time.Second)),
+			})
+			if isFailed && !failed[ev.Package] {
+				report.Failures = append(report.Failures, failure(ev.Package, "", outputs[key]))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	report.Failures = leaves(report.Failures)
+	return report, nil
+}
+
+// failure is the failure of the test with the output provided, without the lines go test adds around it
+func failure(pkg string, test string, output []string) event.TestFailure {
+	f := event.TestFailure{Package: pkg, Test: test}
+	var lines []string
+	for _, line := range output {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "FAIL" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") ||
+			strings.HasPrefix(trimmed, "FAIL\t") || strings.HasPrefix(trimmed, "# ") {
+			continue
+		}
+		if f.Location == "" {
+			f.Location = location.FindString(trimmed)
+		}
+		lines = append(lines, trimmed)
+	}
+	f.Output = strings.Join(lines, "\n")
+	return f
+}
+
+// leaves drops the failures of tests whose subtests failed, as those tell what went wrong
+func leaves(failures []event.TestFailure) []event.TestFailure {
+	var result []event.TestFailure
+	for _, f := range failures {
+		hasFailedSubtest := false
+		for _, other := range failures {
+			if f.Test != "" && other.Package == f.Package && strings.HasPrefix(other.Test, f.Test+"/") {
+				hasFailedSubtest = true
+				break
+			}
+		}
+		if !hasFailedSubtest {
+			result = append(result, f)
+		}
+	}
+	return result
+}
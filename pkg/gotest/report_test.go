@@ -0,0 +1,49 @@
+package gotest
+
+import (
+	"strings"
+	"testing"
+)
+
+const testOutput = `{"Action":"run","Package":"example.com/app/a","Test":"TestSum"}
+{"Action":"output","Package":"example.com/app/a","Test":"TestSum","Output":"=== RUN   TestSum\n"}
+{"Action":"run","Package":"example.com/app/a","Test":"TestSum/negative"}
+{"Action":"output","Package":"example.com/app/a","Test":"TestSum/negative","Output":"    a_test.go:12: want: -3, got: 3\n"}
+{"Action":"output","Package":"example.com/app/a","Test":"TestSum/negative","Output":"--- FAIL: TestSum/negative (0.00s)\n"}
+{"Action":"fail","Package":"example.com/app/a","Test":"TestSum/negative","Elapsed":0}
+{"Action":"fail","Package":"example.com/app/a","Test":"TestSum","Elapsed":0}
+{"Action":"output","Package":"example.com/app/a","Output":"FAIL\n"}
+{"Action":"fail","Package":"example.com/app/a","Elapsed":0.25}
+{"Action":"pass","Package":"example.com/app/b","Test":"TestB","Elapsed":0}
+{"Action":"pass","Package":"example.com/app/b","Elapsed":0.1}
+{"ImportPath":"example.com/app/c [example.com/app/c.test]","Action":"build-output","Output":"# example.com/app/c [example.com/app/c.test]\n"}
+{"ImportPath":"example.com/app/c [example.com/app/c.test]","Action":"build-output","Output":"c/c.go:3:2: undefined: missing\n"}
+{"Action":"fail","Package":"example.com/app/c","Elapsed":0}
+`
+
+func TestParseReport(t *testing.T) {
+	report, err := ParseReport(strings.NewReader(testOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPassed := map[string]bool{"example.com/app/a": false, "example.com/app/b": true, "example.com/app/c": false}
+	if len(report.Packages) != len(wantPassed) {
+		t.Fatalf("want: %d packages, got: %v", len(wantPassed), report.Packages)
+	}
+	for _, pkg := range report.Packages {
+		if pkg.Passed != wantPassed[pkg.Package] {
+			t.Errorf("want: %s passed to be %t, got: %t", pkg.Package, wantPassed[pkg.Package], pkg.Passed)
+		}
+	}
+
+	if len(report.Failures) != 2 {
+		t.Fatalf("want: the failing subtest and the failing build, got: %v", report.Failures)
+	}
+	if f := report.Failures[0]; f.Test != "TestSum/negative" || f.Location != "a_test.go:12" || f.Output != "a_test.go:12: want: -3, got: 3" {
+		t.Errorf("want: TestSum/negative failing at a_test.go:12, got: %+v", f)
+	}
+	if f := report.Failures[1]; f.Package != "example.com/app/c" || f.Test != "" || f.Location != "c/c.go:3" {
+		t.Errorf("want: example.com/app/c failing to build at c/c.go:3, got: %+v", f)
+	}
+}
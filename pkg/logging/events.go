@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/event"
+)
+
+// Follow logs the events pending until the Pending is closed. A Pending merging the events with event.Append
+// logs every event, e.g. a failed build published during a flood of samples.
+func (l *Logger) Follow(p *event.Pending) {
+	for {
+		select {
+		case <-p.Ready():
+			l.events(p.Take())
+		case <-p.Done():
+			l.events(p.Take())
+			return
+		}
+	}
+}
+
+// events logs the events of a batch, or the event provided
+func (l *Logger) events(ev event.Event) {
+	for _, ev := range event.Events(ev) {
+		l.Event(ev)
+	}
+}
+
+// Event logs the event provided
+func (l *Logger) Event(ev event.Event) {
+	switch ev := ev.(type) {
+	case event.FilesChanged:
+		l.Detection("change detected: %s", strings.Join(ev.Paths, ", "))
+	case event.ConfigurationChanged:
+		l.Main("%s", "configuration changed, reloading")
+	case event.BuildStarted:
+		l.Build("%s", "building")
+	case event.BuildFinished:
+		if ev.Err != nil {
+			l.Main("error: during build: %s", ev.Err)
+			return
+		}
+		if ev.Cached {
+			l.Build("reused the build of unchanged sources in %s", ev.Duration.Round(time.Millisecond))
+			return
+		}
+		l.Build("finished building in %s", ev.Duration.Round(time.Millisecond))
+	case event.AppStarted:
+		l.Run("running with pid %d", ev.Pid)
+	case event.AppExited:
+		l.Run("stopped running with exit code %d", ev.Code)
+	case event.SyncSent:
+		l.Sync("synced %d browsers", ev.Clients)
+	case event.CycleTimed:
+		l.Status("reloaded in %s: wait %s, build %s, %s %s", ev.Total.Round(time.Millisecond),
+			ev.Timing.Wait.Round(time.Millisecond), ev.Timing.Build.Round(time.Millisecond),
+			StartupStage(ev.Timing.Ready), ev.Timing.Startup.Round(time.Millisecond))
+	case event.TestsStarted:
+		l.Test("testing %s", strings.Join(ev.Packages, ", "))
+	case event.TestsFinished:
+		l.testsFinished(ev)
+	case event.LintFinished:
+		l.lintFinished(ev)
+	case event.ResourcesSampled:
+		l.Status("pid %d: %s rss, %.1f%% cpu, %s cpu time, %d open files",
+			ev.Pid, formatBytes(ev.RSS), ev.CPU, ev.CPUTime.Round(time.Millisecond), ev.OpenFiles)
+	case event.LimitExceeded:
+		l.limitExceeded(ev)
+	}
+}
+
+// limitExceeded logs the limit the binary reached and what became of it
+func (l *Logger) limitExceeded(ev event.LimitExceeded) {
+	usage, max := fmt.Sprint(ev.Usage), fmt.Sprint(ev.Max)
+	if ev.Limit == "max_memory" {
+		usage, max = formatBytes(ev.Usage), formatBytes(ev.Max)
+	}
+	switch {
+	case ev.Killed && ev.Usage == 0:
+		l.Main("error: pid %d was killed for exceeding its %s of %s", ev.Pid, ev.Limit, max)
+	case ev.Killed:
+		l.Main("error: pid %d was killed for exceeding its %s of %s with %s", ev.Pid, ev.Limit, max, usage)
+	default:
+		l.Main("error: pid %d reached its %s of %s with %s", ev.Pid, ev.Limit, max, usage)
+	}
+}
+
+// formatBytes formats the number of bytes in the largest binary unit below it
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// StartupStage names the startup of a cycle, which is only until spawned without a ready check
+func StartupStage(ready bool) string {
+	if ready {
+		return "startup"
+	}
+	return "spawn"
+}
+
+// lintFinished logs the findings of the lint commands and whether they kept the binary from restarting
+func (l *Logger) lintFinished(ev event.LintFinished) {
+	if ev.Err != nil {
+		l.Main("error: during lint: %s", ev.Err)
+	}
+	for _, d := range ev.Diagnostics {
+		location := fmt.Sprintf("%s:%d", d.File, d.Line)
+		if d.Column > 0 {
+			location = fmt.Sprintf("%s:%d", location, d.Column)
+		}
+		l.Build("%s: %s", location, d.Message)
+	}
+	if ev.Blocked {
+		l.Main("%s", "lint findings, keeping the previous binary running")
+		return
+	}
+	l.Build("linted in %s: %d findings", ev.Duration.Round(time.Millisecond), len(ev.Diagnostics))
+}
+
+// testsFinished logs the outcome of every package, where and why tests failed and a summary
+func (l *Logger) testsFinished(ev event.TestsFinished) {
+	if ev.Err != nil {
+		l.Main("error: during tests: %s", ev.Err)
+		return
+	}
+	passed := 0
+	for _, pkg := range ev.Packages {
+		if pkg.Passed {
+			passed++
+			l.Test("ok   %s %s", pkg.Package, pkg.Elapsed.Round(time.Millisecond))
+			continue
+		}
+		l.Test("FAIL %s %s", pkg.Package, pkg.Elapsed.Round(time.Millisecond))
+	}
+	for _, f := range ev.Failures {
+		name := f.Test
+		if name == "" {
+			name = f.Package
+		}
+		l.Test("--- FAIL: %s %s", name, f.Location)
+		for _, line := range strings.Split(f.Output, "\n") {
+			l.Test("    %s", line)
+		}
+	}
+	l.Test("tests finished in %s: %d passed, %d failed", ev.Duration.Round(time.Millisecond), passed, len(ev.Packages)-passed)
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+)
+
+// syncBuffer is a buffer written by the follower and read by the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFollowLogsBuildErrorsDuringAFlood(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &syncBuffer{}
+	bus := event.NewBus()
+	p := bus.Pend(func(event.Event) bool { return true }, event.Append)
+	followed := make(chan struct{})
+	go func() {
+		defer close(followed)
+		NewLoggerWithOutput(cfg, out).Follow(p)
+	}()
+
+	for i := 0; i < 1000; i++ {
+		bus.Publish(event.ResourcesSampled{At: time.Now()})
+	}
+	bus.Publish(event.BuildFinished{At: time.Now(), Err: errors.New("undefined: foo")})
+	bus.Close()
+	<-followed
+
+	if !strings.Contains(out.String(), "error: during build: undefined: foo") {
+		t.Errorf("want: the build error logged, got: %q", out.String())
+	}
+}
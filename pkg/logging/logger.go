@@ -2,6 +2,7 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"strings"
@@ -16,7 +17,7 @@ import (
 
 type logFunc func(string, ...interface{}) (n int, err error)
 
-func newLogFunc(color *colorizer.Color, cfg *configuration.LogConfiguration) logFunc {
+func newLogFunc(color *colorizer.Color, cfg *configuration.LogConfiguration, out io.Writer) logFunc {
 	return func(msg string, v ...interface{}) (n int, err error) {
 		msg = trimMessage(msg)
 		if len(msg) == 0 {
@@ -27,7 +28,7 @@ func newLogFunc(color *colorizer.Color, cfg *configuration.LogConfiguration) log
 			msg = addTime(msg)
 		}
 
-		return color.Fprintf(colorizer.Output, msg, v...)
+		return color.Fprintf(out, msg, v...)
 	}
 }
 
@@ -54,12 +55,17 @@ type Logger struct {
 }
 
 func NewLogger(cfg *configuration.Configuration) *Logger {
+	return NewLoggerWithOutput(cfg, colorizer.Output)
+}
+
+// NewLoggerWithOutput creates a Logger writing to the output provided, e.g. when gomon is embedded
+func NewLoggerWithOutput(cfg *configuration.Configuration, out io.Writer) *Logger {
 	colors := cfg.Colors()
 	logFuncs := make(map[string]logFunc, len(colors))
 	for name, color := range colors {
-		logFuncs[name] = newLogFunc(color, cfg.Log)
+		logFuncs[name] = newLogFunc(color, cfg.Log, out)
 	}
-	logFuncs["default"] = defaultLogFunc()
+	logFuncs["default"] = defaultLogFunc(out)
 	return &Logger{
 		config:   cfg,
 		logFuncs: logFuncs,
@@ -87,7 +93,7 @@ func (l *Logger) BuildError(buildError string) error {
 }
 
 func (l *Logger) Main(format string, v ...interface{}) {
-	l.log("Main", format, v)
+	l.log("Main", format, v...)
 }
 
 func (l *Logger) mainFunc() logFunc {
@@ -95,23 +101,32 @@ func (l *Logger) mainFunc() logFunc {
 }
 
 func (l *Logger) Build(format string, v ...interface{}) {
-	l.log("Build", format, v)
+	l.log("Build", format, v...)
 }
 
 func (l *Logger) Run(format string, v ...interface{}) {
-	l.log("Run", format, v)
+	l.log("Run", format, v...)
 }
 
 func (l *Logger) Detection(format string, v ...interface{}) {
-	l.log("Detection", format, v)
+	l.log("Detection", format, v...)
 }
 
 func (l *Logger) Sync(format string, v ...interface{}) {
-	l.log("Sync", format, v)
+	l.log("Sync", format, v...)
 }
 
 func (l *Logger) App(format string, v ...interface{}) {
-	l.log("App", format, v)
+	l.log("App", format, v...)
+}
+
+func (l *Logger) Test(format string, v ...interface{}) {
+	l.log("Test", format, v...)
+}
+
+// Status logs the state of the binary, like the resources it uses
+func (l *Logger) Status(format string, v ...interface{}) {
+	l.log("Status", format, v...)
 }
 
 func (l *Logger) appFunc() logFunc {
@@ -147,6 +162,6 @@ func addTime(msg string) string {
 	return fmt.Sprintf("[%s] %s", t, msg)
 }
 
-func defaultLogFunc() logFunc {
-	return newLogFunc(utils.DefaultColor(), configuration.DefaultConfiguration().Log)
+func defaultLogFunc(out io.Writer) logFunc {
+	return newLogFunc(utils.DefaultColor(), configuration.DefaultConfiguration().Log, out)
 }
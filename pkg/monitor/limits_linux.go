@@ -0,0 +1,267 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// gomonLeaf is the cgroup gomon moves into, so that the one it was started in may enable the memory controller
+const gomonLeaf = "gomon"
+
+// limits are the limits the operating system enforces on a process
+type limits struct {
+	pid int
+	// cgroup is the directory of the cgroup enforcing the memory limit, empty if the monitor enforces it
+	cgroup string
+	// cgroupErr tells why there is no cgroup enforcing the memory limit
+	cgroupErr error
+}
+
+// limit sets the cpu time and open file limits of the process as rlimits, and puts it in a cgroup of its own
+// enforcing the memory limit if the cgroup v2 gomon was started in is configured to be delegated to it.
+// The limits returned are usable even with an error.
+func limit(pid int, cfg *configuration.MonitorConfiguration, d *delegation) (*limits, error) {
+	l := &limits{pid: pid}
+	var errs []string
+	if cfg.MaxOpenFiles > 0 {
+		max := uint64(cfg.MaxOpenFiles)
+		if err := prlimit(pid, syscall.RLIMIT_NOFILE, syscall.Rlimit{Cur: max, Max: max}); err != nil {
+			errs = append(errs, fmt.Sprintf("max_open_files: %s", err))
+		}
+	}
+	if cfg.MaxCPUTime > 0 {
+		// the soft limit signals SIGXCPU, which go programs ignore, the hard limit a second later kills
+		max := uint64(cfg.MaxCPUTime)
+		if err := prlimit(pid, syscall.RLIMIT_CPU, syscall.Rlimit{Cur: max, Max: max + 1}); err != nil {
+			errs = append(errs, fmt.Sprintf("max_cpu_time: %s", err))
+		}
+	}
+	if cfg.MaxMemory > 0 {
+		// without cgroups the monitor kills the process itself
+		if cfg.DelegateCgroup {
+			l.cgroup, l.cgroupErr = memoryCgroup(pid, uint64(cfg.MaxMemory)*megabyte, d)
+		} else {
+			l.cgroupErr = errors.New("monitor.delegate_cgroup is disabled")
+		}
+	}
+	if len(errs) > 0 {
+		return l, errors.New(strings.Join(errs, ", "))
+	}
+	return l, nil
+}
+
+// prlimit sets the limit of the resource of another process, which setrlimit cannot
+func prlimit(pid int, resource int, rlimit syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&rlimit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// hasMemory checks if the operating system enforces the memory limit
+func (l *limits) hasMemory() bool {
+	return l != nil && l.cgroup != ""
+}
+
+// memoryErr tells why the operating system does not enforce the memory limit, nil if it does or there is none
+func (l *limits) memoryErr() error {
+	if l == nil {
+		return nil
+	}
+	return l.cgroupErr
+}
+
+// release removes the cgroup of the process and reports whether the kernel killed it for exceeding the memory limit.
+// The process is moved next to gomon first in case it is still running.
+func (l *limits) release() bool {
+	if !l.hasMemory() {
+		return false
+	}
+	_ = writeCgroup(filepath.Join(filepath.Dir(l.cgroup), gomonLeaf), "cgroup.procs", strconv.Itoa(l.pid))
+	killed := oomKills(l.cgroup) > 0
+	_ = os.Remove(l.cgroup)
+	return killed
+}
+
+// memoryCgroup creates a cgroup next to the leaf of gomon with the memory limit provided and moves the process into it
+func memoryCgroup(pid int, max uint64, d *delegation) (string, error) {
+	parent, err := d.cgroup()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(parent, fmt.Sprintf("gomon-%d", pid))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", err
+	}
+	err = writeCgroup(dir, "memory.max", strconv.FormatUint(max, 10))
+	if err == nil {
+		err = writeCgroup(dir, "cgroup.procs", strconv.Itoa(pid))
+	}
+	if err != nil {
+		_ = os.Remove(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// delegation is what gomon changed in the cgroup it was started in to create cgroups next to itself, so that
+// it can be restored
+type delegation struct {
+	mu sync.Mutex
+	// dir is the cgroup gomon was started in, empty until the memory controller is enabled for its children
+	dir string
+	// moved tells that gomon moved into the leaf, rather than having been started in it
+	moved bool
+	// enabled tells that gomon enabled the memory controller, rather than it having been enabled before
+	enabled bool
+}
+
+// cgroup is the directory of the cgroup gomon was started in, with the memory controller enabled for its
+// children. A cgroup with processes of its own cannot enable controllers for its children, so gomon moves into
+// a leaf of it first. This requires the cgroup to be delegated to gomon, like systemd does with Delegate=yes,
+// and no other processes to be in it, like the shell gomon was started from.
+func (d *delegation) cgroup() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dir != "" {
+		return d.dir, nil
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cgroupRoot, own)
+	moved := false
+	if filepath.Base(dir) == gomonLeaf {
+		// a gomon not restoring its cgroup left it in the leaf
+		dir = filepath.Dir(dir)
+	} else {
+		leaf := filepath.Join(dir, gomonLeaf)
+		if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("during leaf creation: %w", err)
+		}
+		if err := writeCgroup(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			_ = os.Remove(leaf)
+			return "", fmt.Errorf("during move into the leaf: %w", err)
+		}
+		moved = true
+	}
+	enabled := !hasController(dir, "memory")
+	if enabled {
+		if err := writeCgroup(dir, "cgroup.subtree_control", "+memory"); err != nil {
+			d.dir, d.moved = dir, moved
+			_ = d.restoreLocked()
+			return "", fmt.Errorf("during memory controller activation: %w", err)
+		}
+	}
+	d.dir, d.moved, d.enabled = dir, moved, enabled
+	return dir, nil
+}
+
+// restore undoes the changes to the cgroup gomon was started in, once the cgroups of the processes are removed
+func (d *delegation) restore() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.restoreLocked()
+}
+
+func (d *delegation) restoreLocked() error {
+	if d.dir == "" {
+		return nil
+	}
+	var errs []string
+	// a cgroup with controllers enabled for its children cannot take processes back
+	if d.enabled {
+		if err := writeCgroup(d.dir, "cgroup.subtree_control", "-memory"); err != nil {
+			errs = append(errs, fmt.Sprintf("during memory controller deactivation: %s", err))
+		}
+	}
+	if d.moved {
+		if err := writeCgroup(d.dir, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+			errs = append(errs, fmt.Sprintf("during move out of the leaf: %s", err))
+		} else if err := os.Remove(filepath.Join(d.dir, gomonLeaf)); err != nil {
+			errs = append(errs, fmt.Sprintf("during leaf removal: %s", err))
+		}
+	}
+	d.dir, d.moved, d.enabled = "", false, false
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// hasController checks if the controller is enabled for the children of the cgroup
+func hasController(dir string, controller string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return false
+	}
+	for _, enabled := range strings.Fields(string(data)) {
+		if enabled == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// ownCgroup is the path of the cgroup v2 gomon is in, relative to the root of the hierarchy
+func ownCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("no cgroup v2 hierarchy: %w", err)
+	}
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", errors.New("no cgroup v2 membership")
+}
+
+func writeCgroup(dir string, file string, value string) error {
+	return ioutil.WriteFile(filepath.Join(dir, file), []byte(value), 0o644)
+}
+
+// oomKills is how many processes of the cgroup the kernel killed for exceeding its memory limit
+func oomKills(dir string) int {
+	f, err := os.Open(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// kill kills the process group of the process, or the process alone if it leads none
+func kill(pid int) error {
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err == nil {
+		return nil
+	}
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"errors"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+)
+
+// limits are not supported, the resources cannot be sampled either
+type limits struct{}
+
+// delegation is not supported, there are no cgroups
+type delegation struct{}
+
+func (d *delegation) restore() error {
+	return nil
+}
+
+func limit(pid int, cfg *configuration.MonitorConfiguration, d *delegation) (*limits, error) {
+	return nil, errors.New("limits are not supported on windows")
+}
+
+func (l *limits) hasMemory() bool {
+	return false
+}
+
+func (l *limits) memoryErr() error {
+	return nil
+}
+
+func (l *limits) release() bool {
+	return false
+}
+
+func kill(pid int) error {
+	return errors.New("killing is not supported on windows")
+}
@@ -0,0 +1,208 @@
+// Package monitor samples the resources of the running binary and enforces limits on them
+package monitor
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+// The keys of the limits in the monitor configuration, which LimitExceeded reports
+const (
+	MaxMemory    = "max_memory"
+	MaxCPUTime   = "max_cpu_time"
+	MaxOpenFiles = "max_open_files"
+)
+
+// megabyte is the unit of the memory limit
+const megabyte = 1024 * 1024
+
+// Usage are the resources a process uses
+type Usage struct {
+	// RSS is the resident memory in bytes
+	RSS       uint64
+	CPUTime   time.Duration
+	OpenFiles int
+}
+
+// Monitor samples the resources of every binary started and enforces the configured limits on them
+type Monitor struct {
+	config       *configuration.Configuration
+	logger       *logging.Logger
+	events       *event.Bus
+	subscription *event.Subscription
+	// pollsMemory logs once that the memory limit is enforced by sampling
+	pollsMemory sync.Once
+	// cgroups is what was changed in the cgroup gomon was started in, to be restored once no binary is watched
+	cgroups delegation
+}
+
+// NewMonitor creates a Monitor following the binaries started from now on
+func NewMonitor(cfg *configuration.Configuration, l *logging.Logger, events *event.Bus) *Monitor {
+	return &Monitor{
+		config:       cfg,
+		logger:       l,
+		events:       events,
+		subscription: events.Subscribe(),
+	}
+}
+
+// Run monitors the binaries until the context is done, a binary is monitored from its start until it exited
+func (m *Monitor) Run(ctx context.Context) error {
+	defer m.subscription.Close()
+	if !isSupported {
+		m.logger.Main("resource monitoring is not supported on %s", runtime.GOOS)
+		return nil
+	}
+	if m.config.Debug && m.config.HasLimits() {
+		m.logger.Main("%s", "resource limits are not enforced while debugging, the binary is only sampled")
+	}
+
+	var wg sync.WaitGroup
+	watched := make(map[int]context.CancelFunc)
+	defer func() {
+		for _, cancel := range watched {
+			cancel()
+		}
+		wg.Wait()
+		if err := m.cgroups.restore(); err != nil {
+			m.logger.Main("error: during cgroup restoration: %s", err)
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-m.subscription.Events():
+			if !ok {
+				return nil
+			}
+			switch ev := ev.(type) {
+			case event.AppStarted:
+				watchCtx, cancel := context.WithCancel(ctx)
+				watched[ev.Pid] = cancel
+				wg.Add(1)
+				go func(pid int) {
+					defer wg.Done()
+					m.watch(watchCtx, pid)
+				}(ev.Pid)
+			case event.AppExited:
+				if cancel, ok := watched[ev.Pid]; ok {
+					cancel()
+					delete(watched, ev.Pid)
+				}
+			}
+		}
+	}
+}
+
+// watch limits the process and samples it until the context is done or the process is gone.
+// While debugging the process is delve, which runs the binary as its child and holds it at breakpoints,
+// so the child is sampled once it was started and no limits are enforced.
+func (m *Monitor) watch(ctx context.Context, pid int) {
+	var limits *limits
+	if !m.config.Debug {
+		var err error
+		limits, err = limit(pid, m.config.Monitor, &m.cgroups)
+		if err != nil {
+			m.logger.Main("error: during limiting of pid %d: %s", pid, err)
+		}
+		if err := limits.memoryErr(); err != nil {
+			m.pollsMemory.Do(func() {
+				m.logger.Main("memory limits are only enforced by sampling every %s, as no cgroup can enforce them: %s", m.config.MonitorInterval(), err)
+			})
+		}
+		defer func() {
+			if limits.release() {
+				m.exceeded(pid, MaxMemory, 0, false)
+			}
+		}()
+	}
+
+	s := &sampler{pid: pid, exceeded: make(map[string]bool)}
+	isResolved := !m.config.Debug
+	ticker := time.NewTicker(m.config.MonitorInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !isResolved {
+				debuggee, ok := child(pid)
+				if !ok {
+					continue
+				}
+				s.pid, isResolved = debuggee, true
+			}
+			usage, err := sample(s.pid)
+			if err != nil {
+				// the process exited in between
+				return
+			}
+			if m.config.Monitor.Interval > 0 {
+				m.events.Publish(s.sampled(usage))
+			}
+			if !m.config.Debug {
+				m.check(s, usage, limits)
+			}
+		}
+	}
+}
+
+// check publishes the limits the usage reached for the first time, and kills the process for exceeding
+// the memory limit unless the operating system enforces it
+func (m *Monitor) check(s *sampler, usage Usage, limits *limits) {
+	cfg := m.config.Monitor
+	if cfg.MaxMemory > 0 && !limits.hasMemory() && usage.RSS > uint64(cfg.MaxMemory)*megabyte && !s.exceeded[MaxMemory] {
+		s.exceeded[MaxMemory] = true
+		err := kill(s.pid)
+		if err != nil {
+			m.logger.Main("error: during kill of pid %d: %s", s.pid, err)
+		}
+		m.exceeded(s.pid, MaxMemory, usage.RSS, err == nil)
+	}
+	if cfg.MaxCPUTime > 0 && usage.CPUTime >= time.Duration(cfg.MaxCPUTime)*time.Second && !s.exceeded[MaxCPUTime] {
+		s.exceeded[MaxCPUTime] = true
+		m.exceeded(s.pid, MaxCPUTime, uint64(usage.CPUTime/time.Second), false)
+	}
+	if cfg.MaxOpenFiles > 0 && usage.OpenFiles >= cfg.MaxOpenFiles && !s.exceeded[MaxOpenFiles] {
+		s.exceeded[MaxOpenFiles] = true
+		m.exceeded(s.pid, MaxOpenFiles, uint64(usage.OpenFiles), false)
+	}
+}
+
+// exceeded publishes that the process reached the limit, a usage of 0 is unknown
+func (m *Monitor) exceeded(pid int, limit string, usage uint64, killed bool) {
+	max := map[string]uint64{
+		MaxMemory:    uint64(m.config.Monitor.MaxMemory) * megabyte,
+		MaxCPUTime:   uint64(m.config.Monitor.MaxCPUTime),
+		MaxOpenFiles: uint64(m.config.Monitor.MaxOpenFiles),
+	}[limit]
+	m.events.Publish(event.LimitExceeded{At: time.Now(), Pid: pid, Limit: limit, Usage: usage, Max: max, Killed: killed})
+}
+
+// sampler keeps what is needed across the samples of a process
+type sampler struct {
+	pid int
+	// exceeded are the limits already reported
+	exceeded map[string]bool
+	prev     Usage
+	prevAt   time.Time
+}
+
+// sampled is the event of the usage, the cpu share is taken since the previous sample
+func (s *sampler) sampled(usage Usage) event.ResourcesSampled {
+	now := time.Now()
+	ev := event.ResourcesSampled{At: now, Pid: s.pid, RSS: usage.RSS, CPUTime: usage.CPUTime, OpenFiles: usage.OpenFiles}
+	if !s.prevAt.IsZero() {
+		ev.CPU = float64(usage.CPUTime-s.prev.CPUTime) / float64(now.Sub(s.prevAt)) * 100
+	}
+	s.prev, s.prevAt = usage, now
+	return ev
+}
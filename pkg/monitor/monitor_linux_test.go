@@ -0,0 +1,242 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+func TestParseStat(t *testing.T) {
+	stat := "4242 (my (odd) app) S 1 4242 4242 0 -1 4194560 1000 0 0 0 250 50 0 0 20 0 8 0 100 800000000 3000 18446744073709551615"
+	usage, err := ParseStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 3 * time.Second; usage.CPUTime != want {
+		t.Errorf("got cpu time %s, want: %s", usage.CPUTime, want)
+	}
+	if want := uint64(3000 * os.Getpagesize()); usage.RSS != want {
+		t.Errorf("got rss %d, want: %d", usage.RSS, want)
+	}
+
+	if _, err := ParseStat("4242 (app) S 1"); err == nil {
+		t.Error("want an error for missing fields")
+	}
+}
+
+func TestResourcesSampled(t *testing.T) {
+	cfg := monitorConfiguration(t)
+	cfg.Monitor.Interval = 10
+	events, cmd := monitorProcess(t, cfg, "sleep", "10")
+
+	ev := awaitEvent(t, events, func(ev event.Event) bool {
+		sampled, ok := ev.(event.ResourcesSampled)
+		return ok && sampled.Pid == cmd.Process.Pid
+	}).(event.ResourcesSampled)
+	if ev.RSS == 0 || ev.OpenFiles == 0 {
+		t.Errorf("got %+v, want the rss and open files of the process", ev)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	cfg := monitorConfiguration(t)
+	cfg.Monitor.Interval = 10
+	cfg.Monitor.MaxMemory = 1
+	// the shell holds megabytes of output in memory
+	events, cmd := monitorProcess(t, cfg, "sh", "-c", `x=$(head -c 8000000 /dev/zero | tr '\0' a); sleep 10`)
+
+	ev := awaitEvent(t, events, func(ev event.Event) bool {
+		exceeded, ok := ev.(event.LimitExceeded)
+		return ok && exceeded.Limit == MaxMemory
+	}).(event.LimitExceeded)
+	if !ev.Killed || ev.Pid != cmd.Process.Pid {
+		t.Errorf("got %+v, want the process killed", ev)
+	}
+}
+
+func TestOpenFilesLimit(t *testing.T) {
+	cfg := monitorConfiguration(t)
+	// the limit leaves room for the dynamic loader, which the limit may be set before.
+	// The shell waits for its input with a builtin, as nothing could be executed at the limit.
+	cfg.Monitor.MaxOpenFiles = 8
+	events, cmd := monitorProcess(t, cfg, "sh", "-c", "exec 3</dev/null 4</dev/null 5</dev/null 6</dev/null 7</dev/null; read x")
+
+	ev := awaitEvent(t, events, func(ev event.Event) bool {
+		exceeded, ok := ev.(event.LimitExceeded)
+		return ok && exceeded.Limit == MaxOpenFiles
+	}).(event.LimitExceeded)
+	if ev.Killed || ev.Usage != 8 || ev.Max != 8 {
+		t.Errorf("got %+v, want the open files reported", ev)
+	}
+
+	limits, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/limits", cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(limits), "\n") {
+		if strings.HasPrefix(line, "Max open files") {
+			if fields := strings.Fields(line); fields[3] != "8" || fields[4] != "8" {
+				t.Errorf("got %q, want the rlimit set", line)
+			}
+		}
+	}
+}
+
+func monitorConfiguration(t *testing.T) *configuration.Configuration {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// monitorProcess starts the command and a monitor following it, both are stopped once the test finished.
+// The input of the command is kept open until then.
+func monitorProcess(t *testing.T, cfg *configuration.Configuration, name string, args ...string) (*event.Subscription, *exec.Cmd) {
+	bus := event.NewBus()
+	events := bus.Subscribe()
+	m := NewMonitor(cfg, logging.NewLoggerWithOutput(cfg, ioutil.Discard), bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		bus.Publish(event.AppExited{At: time.Now(), Pid: cmd.Process.Pid})
+		close(exited)
+	}()
+	bus.Publish(event.AppStarted{At: time.Now(), Pid: cmd.Process.Pid})
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		<-exited
+		input.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		bus.Close()
+	})
+	return events, cmd
+}
+
+// awaitEvent returns the first event matching
+func awaitEvent(t *testing.T, events *event.Subscription, matches func(event.Event) bool) event.Event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events.Events():
+			if matches(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("the event was not published")
+			return nil
+		}
+	}
+}
+
+func TestDebuggeeSampledWithoutLimits(t *testing.T) {
+	cfg := monitorConfiguration(t)
+	cfg.Debug = true
+	cfg.Monitor.Interval = 10
+	cfg.Monitor.MaxOpenFiles = 8
+	// the shell stands in for delve, which runs the binary as its child
+	events, cmd := monitorProcess(t, cfg, "sh", "-c", "sleep 10; true")
+
+	ev := awaitEvent(t, events, func(ev event.Event) bool {
+		_, ok := ev.(event.ResourcesSampled)
+		return ok
+	}).(event.ResourcesSampled)
+	if ev.Pid == cmd.Process.Pid {
+		t.Errorf("got pid %d, want: the child of pid %d sampled", ev.Pid, cmd.Process.Pid)
+	}
+
+	limits, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/limits", cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(limits), "\n") {
+		if strings.HasPrefix(line, "Max open files") {
+			if fields := strings.Fields(line); fields[3] == "8" {
+				t.Errorf("got %q, want no rlimit set while debugging", line)
+			}
+		}
+	}
+}
+
+func TestMemoryLimitEnforcement(t *testing.T) {
+	own, ownErr := ownCgroup()
+	cfg := monitorConfiguration(t)
+	cfg.Monitor.MaxMemory = 64
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	// the cgroup gomon was started in is left alone unless it is delegated
+	var d delegation
+	l, err := limit(cmd.Process.Pid, cfg.Monitor, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.hasMemory() || l.memoryErr() == nil || d.dir != "" {
+		t.Errorf("got cgroup %q, error %v, want: the memory limit polled as no cgroup is delegated", l.cgroup, l.memoryErr())
+	}
+
+	cfg.Monitor.DelegateCgroup = true
+	l, err = limit(cmd.Process.Pid, cfg.Monitor, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case ownErr != nil && (l.hasMemory() || l.memoryErr() == nil):
+		t.Errorf("got cgroup %q, error %v, want: the memory limit polled without cgroups v2", l.cgroup, l.memoryErr())
+	case l.hasMemory() == (l.memoryErr() != nil):
+		t.Errorf("got cgroup %q, error %v, want: either a cgroup or the reason for polling", l.cgroup, l.memoryErr())
+	case l.hasMemory():
+		max, err := ioutil.ReadFile(fmt.Sprintf("%s/memory.max", l.cgroup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprint(64 * megabyte); strings.TrimSpace(string(max)) != want {
+			t.Errorf("got memory.max %q, want: %s", max, want)
+		}
+	}
+	l.release()
+
+	if err := d.restore(); err != nil {
+		t.Fatal(err)
+	}
+	if ownErr == nil {
+		if restored, err := ownCgroup(); err != nil || restored != own {
+			t.Errorf("got cgroup %q, want: %q restored", restored, own)
+		}
+	}
+}
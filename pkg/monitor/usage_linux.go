@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isSupported is whether the resources can be sampled on this operating system
+const isSupported = true
+
+// clockTicks is the unit of the cpu times in /proc, USER_HZ is 100 on every architecture linux runs on
+const clockTicks = 100
+
+// sample reads the resources the process uses from /proc
+func sample(pid int) (Usage, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	stat, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return Usage{}, err
+	}
+	usage, err := ParseStat(string(stat))
+	if err != nil {
+		return Usage{}, fmt.Errorf("during stat parsing: %w", err)
+	}
+	fds, err := ioutil.ReadDir(dir + "/fd")
+	if err != nil {
+		return Usage{}, err
+	}
+	usage.OpenFiles = len(fds)
+	return usage, nil
+}
+
+// child is the first child process of the process, false if it has none (yet)
+func child(pid int) (int, bool) {
+	children, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/children", pid, pid))
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(children))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	child, err := strconv.Atoi(fields[0])
+	return child, err == nil
+}
+
+// ParseStat reads the cpu time and resident memory of the contents of /proc/<pid>/stat
+func ParseStat(stat string) (Usage, error) {
+	// the command name in parentheses may contain spaces and parentheses itself
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return Usage{}, fmt.Errorf("no command name in %q", stat)
+	}
+	// the fields following the command name, starting with the state as field 3
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return Usage{}, fmt.Errorf("expected at least 24 fields, got %d", len(fields)+2)
+	}
+	// utime and stime in clock ticks, rss in pages
+	var values [3]uint64
+	for i, field := range []int{14, 15, 24} {
+		n, err := strconv.ParseUint(fields[field-3], 10, 64)
+		if err != nil {
+			return Usage{}, err
+		}
+		values[i] = n
+	}
+	return Usage{
+		CPUTime: time.Duration(values[0]+values[1]) * time.Second / clockTicks,
+		RSS:     values[2] * uint64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,16 @@
+package monitor
+
+import "errors"
+
+// isSupported is whether the resources can be sampled on this operating system
+const isSupported = false
+
+// sample is not supported, there is no /proc to read the resources from
+func sample(pid int) (Usage, error) {
+	return Usage{}, errors.New("resource monitoring is not supported on windows")
+}
+
+// child is not supported, the processes are never sampled
+func child(pid int) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,70 @@
+package reload
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// listeners are the listeners passed to the binary, the configured listener is opened once and kept open across
+// restarts so that connections queue up in its backlog instead of being refused while there is no binary
+func (r *Reload) listeners() ([]*os.File, error) {
+	addr := r.config.Listen.Address
+	if addr == "" {
+		return nil, nil
+	}
+	if r.listener != nil {
+		return []*os.File{r.listener}, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("during listen: %w", err)
+	}
+	// the file is a duplicate which keeps the socket open once the listener is closed
+	f, err := l.(*net.TCPListener).File()
+	l.Close()
+	if err != nil {
+		return nil, fmt.Errorf("during listen: %w", err)
+	}
+	r.listener = f
+	r.logger.Main("listening on %s for the binary", l.Addr())
+	return []*os.File{f}, nil
+}
+
+// Close closes the listener passed to the binary, connections queued up for it are refused from then on
+func (r *Reload) Close() error {
+	r.closeNotifier()
+	if r.listener == nil {
+		return nil
+	}
+	err := r.listener.Close()
+	r.listener = nil
+	return err
+}
+
+// activated makes the shell hand its pid over to the command as LISTEN_PID, as the protocol requires the pid
+// of the process the listeners are meant for, which is only known once the shell started
+func activated(cmd string, files []*os.File) string {
+	if len(files) == 0 {
+		return cmd
+	}
+	return "export LISTEN_PID=$$; exec " + cmd
+}
+
+// activatedArgs run the program through a shell handing its pid over as LISTEN_PID like activated does.
+// The arguments are passed to the shell as its own, it never interprets them.
+func activatedArgs(args []string, files []*os.File) []string {
+	if len(files) == 0 {
+		return args
+	}
+	return append([]string{"/bin/sh", "-c", `export LISTEN_PID=$$; exec "$0" "$@"`}, args...)
+}
+
+// activationEnv tells the command how many listeners were passed, the protocol starts them at file descriptor 3
+func activationEnv(files []*os.File) []string {
+	if len(files) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("LISTEN_FDS=%d", len(files))}
+}
@@ -0,0 +1,68 @@
+package reload
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+func TestSocketActivation(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Listen.Address = "127.0.0.1:0"
+	// the binary checks that the listener was passed to itself at file descriptor 3
+	cfg.Build.ExecutionCommand = `sh -c 'echo "$LISTEN_FDS $LISTEN_PID $$ $(readlink /proc/$$/fd/3)"'`
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	defer func() {
+		if err := reloader.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var sockets []string
+	for i := 0; i < 2; i++ {
+		fields := strings.Fields(runActivated(t, reloader))
+		if len(fields) != 4 || fields[0] != "1" || fields[1] != fields[2] || !strings.HasPrefix(fields[3], "socket:") {
+			t.Fatalf("got %q, want one listener for the pid of the binary", fields)
+		}
+		sockets = append(sockets, fields[3])
+	}
+	if sockets[0] != sockets[1] {
+		t.Errorf("got sockets %s and %s, want the listener kept across restarts", sockets[0], sockets[1])
+	}
+}
+
+// runActivated runs the binary until it exited and returns the first line it printed
+func runActivated(t *testing.T, reloader *Reload) string {
+	r, w := io.Pipe()
+	defer r.Close()
+	process, err := reloader.Runner.Run(w, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := process.Wait(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		lines <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("the binary printed nothing")
+		return ""
+	}
+}
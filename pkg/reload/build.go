@@ -1,39 +1,165 @@
 package reload
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"os/exec"
+	"strings"
 
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
-// BuildCleanup stops the build
-func (r *Reload) BuildCleanup() {
-	select {
-	case <-r.startBuilding:
-		r.stop <- true
-	default:
-	}
+// cmdBuilder builds with the configured build command
+type cmdBuilder struct {
+	reload *Reload
 }
 
-func (r *Reload) build() error {
-	binary, err := r.config.Binary()
+// Build runs go build with the structured build options or the build arguments. Other build commands
+// get the binary, the flags and the source dir appended, unless they place them with placeholders.
+func (b *cmdBuilder) Build(ctx context.Context, out io.Writer) error {
+	data, err := b.reload.placeholders()
 	if err != nil {
 		return err
 	}
-	srcDir, err := r.config.SrcDir()
+	build := b.reload.buildConfiguration()
+	if len(build.Args) > 0 {
+		args, err := fillInArgs(build.Args, data)
+		if err != nil {
+			return err
+		}
+		return b.reload.runArgs(ctx, args, nil, out)
+	}
+
+	args, isGoBuild, err := goBuildArgs(build, data.Binary, data.SrcDir)
 	if err != nil {
 		return err
 	}
-	buildCmd := fmt.Sprintf("%s %s %s", r.config.Build.Command, binary, srcDir)
-	cmd, stdout, stderr, err := r.StartCmd(buildCmd)
+	if isGoBuild {
+		return b.reload.runArgs(ctx, args, goBuildEnv(build), out)
+	}
+	command := build.Command
+	if isTemplate(command) {
+		return b.reload.runCommand(ctx, command, data, out)
+	}
+	if build.Shell {
+		command = strings.Join(append(append([]string{command, "{{.Binary}}"}, build.Flags...), "{{.SrcDir}}"), " ")
+		return b.reload.runCommand(ctx, command, data, out)
+	}
+	args, err = appendedArgs(build, data)
 	if err != nil {
 		return err
 	}
+	return b.reload.runArgs(ctx, args, nil, out)
+}
+
+// appendedArgs are the arguments of a build command without placeholders, with the binary, the flags and the
+// source dir appended. Each is filled in on its own, so that the binary and the source dir stay single arguments
+// and quoting within a flag is respected like for go build.
+func appendedArgs(b *configuration.BuildConfiguration, data placeholders) ([]string, error) {
+	args, err := commandArgs(b.Command, data)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, data.Binary)
+	for _, flag := range b.Flags {
+		flagArgs, err := utils.SplitArgs(flag)
+		if err != nil {
+			return nil, err
+		}
+		if flagArgs, err = fillInArgs(flagArgs, data); err != nil {
+			return nil, err
+		}
+		args = append(args, flagArgs...)
+	}
+	return append(args, data.SrcDir), nil
+}
+
+// goBuildArgs are the arguments of go build with the structured build options, it reports false if the
+// command is no go build. A trailing -o of the command is dropped as the output is set anyway.
+func goBuildArgs(b *configuration.BuildConfiguration, binary string, srcDir string) ([]string, bool, error) {
+	command, err := utils.SplitArgs(b.Command)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(command) < 2 || command[0] != "go" || command[1] != "build" {
+		return nil, false, nil
+	}
+	if command[len(command)-1] == "-o" {
+		command = command[:len(command)-1]
+	}
+
+	args := append(command, "-o", binary)
+	if len(b.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(b.Tags, ","))
+	}
+	if b.Ldflags != "" {
+		args = append(args, "-ldflags", b.Ldflags)
+	}
+	if b.Gcflags != "" {
+		args = append(args, "-gcflags", b.Gcflags)
+	}
+	if b.Race {
+		args = append(args, "-race")
+	}
+	if b.Trimpath {
+		args = append(args, "-trimpath")
+	}
+	for _, flag := range b.Flags {
+		flagArgs, err := utils.SplitArgs(flag)
+		if err != nil {
+			return nil, false, err
+		}
+		args = append(args, flagArgs...)
+	}
+	return append(args, srcDir), true, nil
+}
+
+// goBuildEnv are the environment variables of the structured build options, unset ones are left to go build
+func goBuildEnv(b *configuration.BuildConfiguration) []string {
+	var env []string
+	if b.CgoEnabled != "" {
+		env = append(env, "CGO_ENABLED="+b.CgoEnabled)
+	}
+	if b.Goos != "" {
+		env = append(env, "GOOS="+b.Goos)
+	}
+	if b.Goarch != "" {
+		env = append(env, "GOARCH="+b.Goarch)
+	}
+	return env
+}
+
+// follow copies the output of the started command to out until it exited, it is killed when the context is done
+func (r *Reload) follow(ctx context.Context, cmd *exec.Cmd, stdout io.ReadCloser, stderr io.ReadCloser, out io.Writer) error {
 	defer func() {
 		stdout.Close()
 		stderr.Close()
 	}()
+
+	finished := make(chan struct{})
+	aborted := make(chan struct{})
+	defer func() {
+		close(finished)
+		<-aborted
+	}()
+	go func() {
+		defer close(aborted)
+		select {
+		case <-ctx.Done():
+			_, _ = r.KillCmd(cmd)
+		case <-finished:
+		}
+	}()
+
+	_, _ = io.Copy(out, stdout)
+	_, _ = io.Copy(out, stderr)
+
+	return cmd.Wait()
+}
+
+// build builds the binary, writing the build output to the build log and out
+func (r *Reload) build(ctx context.Context, out io.Writer) error {
 	buildLog, err := r.logger.BuildLog()
 	if err != nil {
 		return err
@@ -43,8 +169,6 @@ func (r *Reload) build() error {
 			r.logger.Main("%s", err)
 		}
 	}()
-	_, _ = io.Copy(buildLog, stdout)
-	_, _ = io.Copy(buildLog, stderr)
 
-	return cmd.Wait()
+	return r.Builder.Build(ctx, io.MultiWriter(buildLog, out))
 }
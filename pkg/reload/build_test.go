@@ -1,8 +1,11 @@
 package reload
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
@@ -13,9 +16,13 @@ import (
 const (
 	testFile        = "test.go"
 	testFileContent = `package main
-	import "fmt"
+	import (
+		"fmt"
+		"time"
+	)
 	func main() {
 		fmt.Println("hello world")
+		time.Sleep(time.Hour)
 	} 
 `
 )
@@ -49,6 +56,72 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestGoBuildArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(b *configuration.BuildConfiguration)
+		want      []string
+		wantEnv   []string
+	}{
+		{"default", func(b *configuration.BuildConfiguration) {}, []string{"go", "build", "-o", "/bin/my app", "/src"}, nil},
+		{"options", func(b *configuration.BuildConfiguration) {
+			b.Command = "go build -v"
+			b.Tags = []string{"integration", "dev"}
+			b.Ldflags = "-s -w"
+			b.Gcflags = "all=-N -l"
+			b.Race = true
+			b.Trimpath = true
+			b.Flags = []string{"-mod=mod -ldflags='-X main.version=1'"}
+			b.CgoEnabled = "1"
+			b.Goos = "linux"
+			b.Goarch = "arm64"
+		}, []string{
+			"go", "build", "-v", "-o", "/bin/my app", "-tags", "integration,dev", "-ldflags", "-s -w", "-gcflags", "all=-N -l",
+			"-race", "-trimpath", "-mod=mod", "-ldflags=-X main.version=1", "/src",
+		}, []string{"CGO_ENABLED=1", "GOOS=linux", "GOARCH=arm64"}},
+	}
+	for _, tt := range tests {
+		cfg := configuration.DefaultConfiguration()
+		tt.configure(cfg.Build)
+		args, isGoBuild, err := goBuildArgs(cfg.Build, "/bin/my app", "/src")
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !isGoBuild || !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, args, tt.want)
+		}
+		if env := goBuildEnv(cfg.Build); !reflect.DeepEqual(env, tt.wantEnv) {
+			t.Errorf("%s: got env %q, want %q", tt.name, env, tt.wantEnv)
+		}
+	}
+
+	cfg := configuration.DefaultConfiguration()
+	cfg.Build.Command = "make build"
+	if _, isGoBuild, _ := goBuildArgs(cfg.Build, "/bin/app", "/src"); isGoBuild {
+		t.Error("make is no go build")
+	}
+}
+
+func TestAppendedArgs(t *testing.T) {
+	cfg := configuration.DefaultConfiguration()
+	cfg.Build.Command = "tinygo build -target wasi"
+	cfg.Build.Flags = []string{"-ldflags='-X main.greeting=hello world'", "-tags it's"}
+	data := placeholders{Binary: "/my projects/app/main", SrcDir: "/my projects/app"}
+	if _, err := appendedArgs(cfg.Build, data); err == nil {
+		t.Error("want: an error for an unterminated quote, got: none")
+	}
+
+	cfg.Build.Flags = []string{"-ldflags='-X main.greeting=hello world'", "-opt=z"}
+	got, err := appendedArgs(cfg.Build, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tinygo", "build", "-target", "wasi", "/my projects/app/main", "-ldflags=-X main.greeting=hello world", "-opt=z", "/my projects/app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+}
+
 func prepareBuild(srcDir string, buildDir string) error {
 	if err := createSourceDir(srcDir); err != nil {
 		return err
@@ -80,7 +153,7 @@ func buildPrepare(cfg *configuration.Configuration) error {
 }
 
 func buildStart(reloader *Reload) error {
-	return reloader.build()
+	return reloader.build(context.Background(), io.Discard)
 }
 
 func buildPassed(cfg *configuration.Configuration) error {
@@ -95,7 +168,6 @@ func buildPassed(cfg *configuration.Configuration) error {
 }
 
 func buildCleanup(reloader *Reload) error {
-	reloader.BuildCleanup()
 	cfg := reloader.config
 	return cleanupBuild(cfg.Build.RelSrcDir, cfg.Build.RelDir)
 }
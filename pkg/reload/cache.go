@@ -0,0 +1,144 @@
+package reload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// cacheKey identifies the build inputs by the contents of the watched files, the module files pinning the
+// dependencies and how they are built. It reports false if builds are not cached.
+func (r *Reload) cacheKey() (string, bool) {
+	if r.Checksums == nil || r.config.Build.CacheSize == 0 {
+		return "", false
+	}
+	b := r.buildConfiguration()
+	h := sha256.New()
+	// maps are printed sorted by key
+	fmt.Fprintf(h, "%s\x00%q\x00%t\x00%q\x00%q\x00%s\x00%s\x00%t\x00%t\x00%s\x00%s\x00%s\x00%s\x00%v\x00%x",
+		b.Command, b.Args, b.Shell, b.Flags, b.Tags, b.Ldflags, b.Gcflags, b.Race, b.Trimpath, b.CgoEnabled, b.Goos,
+		b.Goarch, b.RelSrcDir, b.Env, r.Checksums.Sum())
+	// the module files are usually not watched, a dependency changes with them nonetheless
+	for _, path := range utils.ModuleFiles(r.config.Root) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", false
+		}
+		fmt.Fprintf(h, "\x00%s\x00%d\x00", path, len(content))
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// cachedBinary is the path the build of the key is kept at
+func (r *Reload) cachedBinary(key string) (string, error) {
+	cacheDir, err := r.config.BuildCacheDir()
+	if err != nil {
+		return "", err
+	}
+	binary, err := r.config.Binary()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, key+filepath.Ext(binary)), nil
+}
+
+// reuse puts the build of the key in place of the binary and reports whether there was one
+func (r *Reload) reuse(key string) (bool, error) {
+	cached, err := r.cachedBinary(key)
+	if err != nil {
+		return false, err
+	}
+	if err := utils.CheckPath(cached); err != nil {
+		return false, nil
+	}
+	binary, err := r.config.Binary()
+	if err != nil {
+		return false, err
+	}
+	if err := copyBinary(cached, binary); err != nil {
+		return false, err
+	}
+	// the modification time tells which builds were used least recently
+	now := time.Now()
+	return true, os.Chtimes(cached, now, now)
+}
+
+// store keeps the built binary for the key and evicts the builds used least recently beyond the cache size.
+// Builders not putting a binary at the configured path are not cached.
+func (r *Reload) store(key string) error {
+	binary, err := r.config.Binary()
+	if err != nil {
+		return err
+	}
+	if err := utils.CheckPath(binary); err != nil {
+		return nil
+	}
+	cached, err := r.cachedBinary(key)
+	if err != nil {
+		return err
+	}
+	if err := utils.CreateAllDirIfNotExist(filepath.Dir(cached)); err != nil {
+		return err
+	}
+	if err := copyBinary(binary, cached); err != nil {
+		return err
+	}
+	return evict(filepath.Dir(cached), r.config.Build.CacheSize)
+}
+
+// evict removes the least recently used builds of the cache dir until size are left
+func evict(cacheDir string, size int) error {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	for i := size; i < len(infos); i++ {
+		if err := utils.RemoveFileIfExist(filepath.Join(cacheDir, infos[i].Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBinary copies the binary instead of linking it, as a build overwriting one of the links in place
+// would change the other as well. It is written to a temporary file first so that no half copy is ever run.
+func copyBinary(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,251 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// countingBuilder writes a binary telling which build it is
+type countingBuilder struct {
+	cfg    *configuration.Configuration
+	builds int
+}
+
+func (b *countingBuilder) Build(ctx context.Context, out io.Writer) error {
+	b.builds++
+	binary, err := b.cfg.Binary()
+	if err != nil {
+		return err
+	}
+	if err := utils.CreateAllDirIfNotExist(filepath.Dir(binary)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(binary, []byte(fmt.Sprintf("build %d", b.builds)), 0o755)
+}
+
+type idleRunner struct{}
+
+func (idleRunner) Run(stdout io.Writer, stderr io.Writer) (Process, error) {
+	return &idleProcess{killed: make(chan struct{})}, nil
+}
+
+type idleProcess struct {
+	killed chan struct{}
+}
+
+func (p *idleProcess) Pid() int { return 42 }
+
+func (p *idleProcess) Kill() error {
+	close(p.killed)
+	return nil
+}
+
+func (p *idleProcess) Wait() (int, error) {
+	<-p.killed
+	return 0, nil
+}
+
+func TestBuildCache(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Build.CacheSize = 2
+	buildDir, err := cfg.BuildDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CreateBuildDirIfNotExist(buildDir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	src := filepath.Join(t.TempDir(), "main.go")
+	builder := &countingBuilder{cfg: cfg}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Builder = builder
+	reloader.Runner = idleRunner{}
+	reloader.Checksums = utils.NewFileChecksums()
+	defer func() {
+		if err := reloader.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	steps := []struct {
+		content string
+		builds  int
+		binary  string
+	}{
+		{"package main // a", 1, "build 1"},
+		{"package main // b", 2, "build 2"},
+		{"package main // a", 2, "build 1"},
+		// evicts b, which was used least recently
+		{"package main // c", 3, "build 3"},
+		{"package main // a", 3, "build 1"},
+		{"package main // b", 4, "build 4"},
+	}
+	for i, step := range steps {
+		if err := ioutil.WriteFile(src, []byte(step.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the same size and modification time would be trusted to be unchanged
+		modTime := time.Now().Add(time.Duration(i-len(steps)) * time.Minute)
+		if err := os.Chtimes(src, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reloader.Checksums.Update(src); err != nil {
+			t.Fatal(err)
+		}
+		if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if builder.builds != step.builds {
+			t.Errorf("step %d: got %d builds, want %d", i, builder.builds, step.builds)
+		}
+		binary, err := cfg.Binary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(binary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != step.binary {
+			t.Errorf("step %d: got binary %q, want %q", i, content, step.binary)
+		}
+	}
+}
+
+func TestBuildCacheMissesOnChangedModuleFiles(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Build.CacheSize = 2
+	cfg.Root = t.TempDir()
+	buildDir, err := cfg.BuildDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CreateBuildDirIfNotExist(buildDir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	builder := &countingBuilder{cfg: cfg}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Builder = builder
+	reloader.Runner = idleRunner{}
+	reloader.Checksums = utils.NewFileChecksums()
+	defer func() {
+		if err := reloader.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	goMod := filepath.Join(cfg.Root, "go.mod")
+	if err := ioutil.WriteFile(goMod, []byte("module example.com/app\n\nrequire example.com/lib v1.0.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		goSum  string
+		builds int
+	}{
+		{"example.com/lib v1.0.0 h1:a=\n", 1},
+		{"example.com/lib v1.0.0 h1:a=\n", 1},
+		// the same version with another hash, e.g. after a go mod download of a republished tag
+		{"example.com/lib v1.0.0 h1:b=\n", 2},
+		{"example.com/lib v1.0.0 h1:a=\n", 2},
+	}
+	for i, step := range steps {
+		if err := ioutil.WriteFile(filepath.Join(cfg.Root, "go.sum"), []byte(step.goSum), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if builder.builds != step.builds {
+			t.Errorf("step %d: got %d builds, want %d", i, builder.builds, step.builds)
+		}
+	}
+}
+
+func TestBuildCacheMissesOnChangedBuildArgs(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Build.CacheSize = 2
+	buildDir, err := cfg.BuildDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CreateBuildDirIfNotExist(buildDir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	builder := &countingBuilder{cfg: cfg}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Builder = builder
+	reloader.Runner = idleRunner{}
+	reloader.Checksums = utils.NewFileChecksums()
+	defer func() {
+		if err := reloader.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	steps := []struct {
+		args   []string
+		builds int
+		binary string
+	}{
+		{[]string{"go", "build", "-o", "{{.Binary}}", "{{.SrcDir}}"}, 1, "build 1"},
+		{[]string{"go", "build", "-race", "-o", "{{.Binary}}", "{{.SrcDir}}"}, 2, "build 2"},
+		{[]string{"go", "build", "-o", "{{.Binary}}", "{{.SrcDir}}"}, 2, "build 1"},
+	}
+	for i, step := range steps {
+		cfg.Build.Args = step.args
+		if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if builder.builds != step.builds {
+			t.Errorf("step %d: got %d builds, want %d", i, builder.builds, step.builds)
+		}
+		binary, err := cfg.Binary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(binary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != step.binary {
+			t.Errorf("step %d: got binary %q, want %q", i, content, step.binary)
+		}
+	}
+}
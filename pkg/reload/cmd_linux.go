@@ -2,20 +2,46 @@ package reload
 
 import (
 	"io"
+	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/creack/pty"
 )
 
-func (r *Reload) StartCmd(cmd string) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
-	c := exec.Command("/bin/sh", "-c", cmd)
+// StartCmd starts the command in a shell with the environment variables provided added, the extra files
+// are passed on as the listeners of socket activation
+func (r *Reload) StartCmd(cmd string, env []string, extraFiles ...*os.File) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+	c := exec.Command("/bin/sh", "-c", activated(cmd, extraFiles))
+	c.Env = append(append(r.config.Environment(), env...), activationEnv(extraFiles)...)
+	c.ExtraFiles = extraFiles
 
 	f, err := pty.Start(c)
 	return c, f, f, err
 }
 
+// StartArgs starts the program of the arguments without a shell, with the environment variables provided added.
+// The extra files are passed on as the listeners of socket activation.
+func (r *Reload) StartArgs(args []string, env []string, extraFiles ...*os.File) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+	args = activatedArgs(args, extraFiles)
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = append(append(r.config.Environment(), env...), activationEnv(extraFiles)...)
+	c.ExtraFiles = extraFiles
+
+	f, err := pty.Start(c)
+	return c, f, f, err
+}
+
+// quoteArg quotes the argument for the shell, single quotes keep everything but single quotes
+func quoteArg(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
 func (r *Reload) KillCmd(cmd *exec.Cmd) (pid int, err error) {
 	pid = cmd.Process.Pid
 
@@ -27,8 +53,5 @@ func (r *Reload) KillCmd(cmd *exec.Cmd) (pid int, err error) {
 
 	// https://stackoverflow.com/questions/22470193/why-wont-go-kill-a-child-process-correctly
 	err = syscall.Kill(-pid, syscall.SIGKILL)
-
-	// Wait releases any resources associated with the Process.
-	_, _ = cmd.Process.Wait()
 	return
 }
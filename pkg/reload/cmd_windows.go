@@ -1,16 +1,24 @@
 package reload
 
 import (
+	"errors"
 	"io"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 )
 
-func (r *Reload) StartCmd(cmd string) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+// StartCmd starts the command in cmd with the environment variables provided added, socket activation
+// is not supported so there may be no extra files
+func (r *Reload) StartCmd(cmd string, env []string, extraFiles ...*os.File) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
 	var err error
+	if len(extraFiles) > 0 {
+		return nil, nil, nil, errors.New("socket activation is not supported on windows")
+	}
 
 	c := exec.Command("cmd", "/c", cmd)
+	c.Env = append(r.config.Environment(), env...)
 	if !strings.Contains(cmd, ".exe") {
 		r.logger.Run("CMD will not recognize non .exe file for execution, path: %s", cmd)
 	}
@@ -30,6 +38,36 @@ func (r *Reload) StartCmd(cmd string) (*exec.Cmd, io.ReadCloser, io.ReadCloser,
 	return c, stdout, stderr, err
 }
 
+// StartArgs starts the program of the arguments without cmd, with the environment variables provided added.
+// Socket activation is not supported so there may be no extra files.
+func (r *Reload) StartArgs(args []string, env []string, extraFiles ...*os.File) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+	if len(extraFiles) > 0 {
+		return nil, nil, nil, errors.New("socket activation is not supported on windows")
+	}
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = append(r.config.Environment(), env...)
+	stderr, err := c.StderrPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, nil, nil, err
+	}
+	return c, stdout, stderr, nil
+}
+
+// quoteArg quotes the argument for cmd if it has spaces or quotes
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"&|<>^") {
+		return arg
+	}
+	return `"` + strings.ReplaceAll(arg, `"`, `""`) + `"`
+}
+
 func (r *Reload) KillCmd(cmd *exec.Cmd) (pid int, err error) {
 	pid = cmd.Process.Pid
 	// https://stackoverflow.com/a/44551450
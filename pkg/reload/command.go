@@ -0,0 +1,150 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// placeholders are filled into the commands and arguments
+type placeholders struct {
+	Binary string
+	SrcDir string
+}
+
+func (r *Reload) placeholders() (placeholders, error) {
+	binary, err := r.config.Binary()
+	if err != nil {
+		return placeholders{}, err
+	}
+	srcDir, err := r.config.SrcDir()
+	if err != nil {
+		return placeholders{}, err
+	}
+	return placeholders{Binary: binary, SrcDir: srcDir}, nil
+}
+
+// isTemplate checks if the command has placeholders
+func isTemplate(command string) bool {
+	return strings.Contains(command, "{{")
+}
+
+// fillIn fills the {{.Binary}} and {{.SrcDir}} placeholders in
+func fillIn(s string, data placeholders) (string, error) {
+	tmpl, err := template.New("").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var filled strings.Builder
+	if err := tmpl.Execute(&filled, data); err != nil {
+		return "", err
+	}
+	return filled.String(), nil
+}
+
+// fillInArgs fills the placeholders into each argument, so that a path with spaces stays a single argument
+func fillInArgs(args []string, data placeholders) ([]string, error) {
+	filled := make([]string, len(args))
+	for i, arg := range args {
+		var err error
+		if filled[i], err = fillIn(arg, data); err != nil {
+			return nil, err
+		}
+	}
+	return filled, nil
+}
+
+// commandArgs splits the command into its arguments before filling the placeholders in
+func commandArgs(command string, data placeholders) ([]string, error) {
+	args, err := utils.SplitArgs(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return fillInArgs(args, data)
+}
+
+// shellCommand fills the placeholders in quoted, so that the shell keeps paths with spaces together
+func shellCommand(command string, data placeholders) (string, error) {
+	return fillIn(command, placeholders{Binary: quoteArg(data.Binary), SrcDir: quoteArg(data.SrcDir)})
+}
+
+// runCommand runs the command in a shell if configured and split into its arguments otherwise
+func (r *Reload) runCommand(ctx context.Context, command string, data placeholders, out io.Writer) error {
+	if r.config.Build.Shell {
+		filled, err := shellCommand(command, data)
+		if err != nil {
+			return err
+		}
+		return r.runCmd(ctx, filled, out)
+	}
+	args, err := commandArgs(command, data)
+	if err != nil {
+		return err
+	}
+	return r.runArgs(ctx, args, nil, out)
+}
+
+// runCmd runs the command in a shell until it exits, writing its output to out. It is killed when the context is done.
+func (r *Reload) runCmd(ctx context.Context, command string, out io.Writer) error {
+	cmd, stdout, stderr, err := r.StartCmd(command, nil)
+	if err != nil {
+		return err
+	}
+	return r.follow(ctx, cmd, stdout, stderr, out)
+}
+
+// runArgs runs the program of the arguments like runCmd, without a shell and with the environment variables added
+func (r *Reload) runArgs(ctx context.Context, args []string, env []string, out io.Writer) error {
+	cmd, stdout, stderr, err := r.StartArgs(args, env)
+	if err != nil {
+		return err
+	}
+	return r.follow(ctx, cmd, stdout, stderr, out)
+}
+
+// startExecution starts the binary with the execution arguments, or with the execution command which is run
+// in a shell if configured and split into its arguments otherwise
+func (r *Reload) startExecution(listeners []*os.File) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
+	data, err := r.placeholders()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b := r.config.Build
+	if b.Shell && len(b.ExecutionArgs) == 0 {
+		command := quoteArg(data.Binary)
+		// the default execution command is the path of the binary
+		if b.ExecutionCommand != data.Binary {
+			if command, err = shellCommand(b.ExecutionCommand, data); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		return r.StartCmd(command, r.notifier.env(), listeners...)
+	}
+	args, err := r.executionArgs(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r.StartArgs(args, r.notifier.env(), listeners...)
+}
+
+// executionArgs are the arguments running the binary without a shell
+func (r *Reload) executionArgs(data placeholders) ([]string, error) {
+	b := r.config.Build
+	if len(b.ExecutionArgs) > 0 {
+		return fillInArgs(b.ExecutionArgs, data)
+	}
+	// the default execution command is the path of the binary, which may contain spaces
+	if b.ExecutionCommand == data.Binary {
+		return []string{data.Binary}, nil
+	}
+	return commandArgs(b.ExecutionCommand, data)
+}
@@ -0,0 +1,33 @@
+package reload
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandArgs(t *testing.T) {
+	data := placeholders{Binary: "/my projects/app/main", SrcDir: "/my projects/app"}
+	got, err := commandArgs(`tinygo build -o {{.Binary}} -ldflags "-s -w" {{.SrcDir}}`, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tinygo", "build", "-o", "/my projects/app/main", "-ldflags", "-s -w", "/my projects/app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := commandArgs("  ", data); err == nil {
+		t.Error("an empty command is no error")
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	data := placeholders{Binary: "/it's/main", SrcDir: "/src"}
+	got, err := shellCommand("make BIN={{.Binary}} SRC={{.SrcDir}} && echo done", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `make BIN='/it'\''s/main' SRC=/src && echo done`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package reload
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/rpc/jsonrpc"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+)
+
+const (
+	// debugGcflags disable optimizations and inlining, so that the debugger sees the code as written
+	debugGcflags = "all=-N -l"
+	// detachTimeout is how long delve may take to kill the binary and exit once told to
+	detachTimeout = 2 * time.Second
+)
+
+// buildConfiguration is the build configuration in effect, in the debug mode it builds for the debugger
+func (r *Reload) buildConfiguration() *configuration.BuildConfiguration {
+	if !r.config.Debug {
+		return r.config.Build
+	}
+	b := *r.config.Build
+	b.Gcflags = debugGcflags
+	return &b
+}
+
+// debugAddr is the address delve accepts debugging clients on
+func (r *Reload) debugAddr() string {
+	return fmt.Sprintf("localhost:%d", r.config.Debugging.Port)
+}
+
+// debugArgs run the execution command under delve, which continues the binary right away
+// and keeps accepting clients, so that debuggers can attach to every new session
+func (r *Reload) debugArgs() ([]string, error) {
+	data, err := r.placeholders()
+	if err != nil {
+		return nil, err
+	}
+	exec, err := r.executionArgs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		r.config.Debugging.Delve, "exec", "--headless", "--accept-multiclient", "--continue", "--api-version=2",
+		"--listen=" + r.debugAddr(), exec[0],
+	}
+	if len(exec) > 1 {
+		args = append(append(args, "--"), exec[1:]...)
+	}
+	return args, nil
+}
+
+// debug starts the binary under delve
+func (rn *cmdRunner) debug(stdout io.Writer, stderr io.Writer) (Process, error) {
+	args, err := rn.reload.debugArgs()
+	if err != nil {
+		return nil, err
+	}
+	// delve passes its environment on to the binary
+	cmd, cmdStdout, cmdStderr, err := rn.reload.StartArgs(args, rn.reload.notifier.env())
+	if err != nil {
+		return nil, err
+	}
+	rn.reload.logger.Main("debugging on %s, attach with dlv connect or an IDE", rn.reload.debugAddr())
+
+	p := &cmdProcess{reload: rn.reload, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		_, _ = io.Copy(stdout, cmdStdout)
+		_, _ = io.Copy(stderr, cmdStderr)
+		cmdStdout.Close()
+		cmdStderr.Close()
+	}()
+	go p.wait()
+	return &delveProcess{cmdProcess: p, addr: rn.reload.debugAddr()}, nil
+}
+
+// delveProcess is delve debugging the binary. Killing delve would leave the binary behind in a process group
+// of its own, so delve is told to kill it and exit instead.
+type delveProcess struct {
+	*cmdProcess
+	addr string
+}
+
+func (p *delveProcess) Kill() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if err := p.detach(); err == nil {
+		select {
+		case <-p.done:
+			return nil
+		case <-time.After(detachTimeout):
+		}
+	}
+	return p.cmdProcess.Kill()
+}
+
+// detachIn are the arguments of the detach call of the delve API
+type detachIn struct {
+	Kill bool
+}
+
+// detach tells delve to kill the binary and exit, it fails if delve could not be reached
+func (p *delveProcess) detach() error {
+	conn, err := net.DialTimeout("tcp", p.addr, detachTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(detachTimeout)); err != nil {
+		return err
+	}
+	// delve may exit before it answers, which is what was asked for
+	var out struct{}
+	_ = jsonrpc.NewClient(conn).Call("RPCServer.Detach", detachIn{Kill: true}, &out)
+	return nil
+}
@@ -0,0 +1,130 @@
+package reload
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+func TestDebugArgs(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Debug = true
+	binary, err := cfg.Binary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	if gcflags := reloader.buildConfiguration().Gcflags; gcflags != debugGcflags {
+		t.Errorf("want: %q, got: %q", debugGcflags, gcflags)
+	}
+
+	cfg.Build.ExecutionCommand = binary + " -port 8080"
+	args, err := reloader.debugArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"dlv", "exec", "--headless", "--accept-multiclient", "--continue", "--api-version=2",
+		"--listen=localhost:2345", binary, "--", "-port", "8080",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("want: %q, got: %q", want, args)
+	}
+}
+
+// fakeDelve answers the detach call of the delve API by killing the debugged process
+type fakeDelve struct {
+	process *cmdProcess
+	killed  chan bool
+}
+
+// DetachIn is detachIn as delve decodes it, net/rpc only serves exported types
+type DetachIn struct {
+	Kill bool
+}
+
+func (d *fakeDelve) Detach(in DetachIn, out *struct{}) error {
+	d.killed <- in.Kill
+	return d.process.cmd.Process.Kill()
+}
+
+func TestDelveKill(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	cmd, stdout, stderr, err := reloader.StartArgs([]string{"sleep", "10"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+	p := &cmdProcess{reload: reloader, cmd: cmd, done: make(chan struct{})}
+	go p.wait()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	delve := &fakeDelve{process: p, killed: make(chan bool, 1)}
+	server := rpc.NewServer()
+	if err := server.RegisterName("RPCServer", delve); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+
+	start := time.Now()
+	if err := (&delveProcess{cmdProcess: p, addr: l.Addr().String()}).Kill(); err != nil {
+		t.Fatal(err)
+	}
+	if !<-delve.killed {
+		t.Error("delve was told to detach without killing the binary")
+	}
+	if elapsed := time.Since(start); elapsed >= detachTimeout {
+		t.Errorf("want: delve told instead of killed, got: killing took %s", elapsed)
+	}
+}
+
+func TestDelveKillUnreachable(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	cmd, stdout, stderr, err := reloader.StartArgs([]string{"sleep", "10"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+	p := &cmdProcess{reload: reloader, cmd: cmd, done: make(chan struct{})}
+	go p.wait()
+
+	// delve not accepting clients yet is killed
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().(*net.TCPAddr)
+	l.Close()
+	if err := (&delveProcess{cmdProcess: p, addr: net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port))}).Kill(); err != nil {
+		t.Fatal(err)
+	}
+}
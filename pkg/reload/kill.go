@@ -1,38 +1,36 @@
 package reload
 
 import (
-	"io"
-	"os"
-	"os/exec"
+	"fmt"
 
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
-func (r *Reload) kill(cmd *exec.Cmd, stdout io.ReadCloser, stderr io.ReadCloser) error {
-	<-r.stopRunning
-	defer func() {
-		stdout.Close()
-		stderr.Close()
-		if err := r.removeBinary(); err != nil {
-			r.logger.Main("error: during kill: %s", err)
-			return
-		}
-		r.FinishedKilling <- true
-		r.logger.Run("%s", "stopped running")
-	}()
+// Stop stops the binary and removes it, it returns once the binary exited
+func (r *Reload) Stop() error {
+	r.mu.Lock()
+	process, exited := r.process, r.exited
+	r.process = nil
+	r.mu.Unlock()
+	if process == nil {
+		return nil
+	}
 
-	var err error
-	_, err = r.KillCmd(cmd)
-	if err != nil {
-		if cmd.ProcessState != nil && !cmd.ProcessState.Exited() {
-			os.Exit(1)
-		}
+	if err := kill(process, exited); err != nil {
 		return err
 	}
-	utils.WithLock(&r.mu, func() {
-		r.running = false
-	})
+	if err := r.removeBinary(); err != nil {
+		return fmt.Errorf("during kill: %w", err)
+	}
+	return nil
+}
 
+// kill kills the process and returns once it exited
+func kill(process Process, exited <-chan struct{}) error {
+	if err := process.Kill(); err != nil {
+		return fmt.Errorf("during kill: %w", err)
+	}
+	<-exited
 	return nil
 }
 
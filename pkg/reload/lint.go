@@ -0,0 +1,75 @@
+package reload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+)
+
+// diagnostic matches the file:line[:column]: message lines of go vet, staticcheck, golangci-lint and alike
+var diagnostic = regexp.MustCompile(`^\s*(?:vet: )?([^\s:]+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// lint runs the lint commands one after the other and publishes their findings.
+// It reports whether the findings block the restart, a command failing without findings never does.
+func (r *Reload) lint(ctx context.Context) bool {
+	commands := r.config.Lint.Commands
+	if len(commands) == 0 {
+		return false
+	}
+
+	data, err := r.placeholders()
+	if err != nil {
+		r.logger.Main("error: during lint: %s", err)
+		return false
+	}
+	start := time.Now()
+	var diagnostics []event.Diagnostic
+	var lintErr error
+	for _, command := range commands {
+		var output bytes.Buffer
+		err := r.runCommand(ctx, command, data, &output)
+		if ctx.Err() != nil {
+			return false
+		}
+		found := ParseDiagnostics(command, output.String())
+		if err != nil && len(found) == 0 && lintErr == nil {
+			lintErr = fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(output.String()))
+		}
+		diagnostics = append(diagnostics, found...)
+	}
+
+	blocked := r.config.Lint.Mode == configuration.LintGate && len(diagnostics) > 0
+	r.Events.Publish(event.LintFinished{
+		At:          time.Now(),
+		Duration:    time.Since(start),
+		Diagnostics: diagnostics,
+		Err:         lintErr,
+		Blocked:     blocked,
+	})
+	return blocked
+}
+
+// ParseDiagnostics extracts the file:line diagnostics from the output of the lint command, other lines are skipped
+func ParseDiagnostics(command string, output string) []event.Diagnostic {
+	var diagnostics []event.Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := diagnostic.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		d := event.Diagnostic{Command: command, File: m[1], Message: strings.TrimSpace(m[4])}
+		d.Line, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			d.Column, _ = strconv.Atoi(m[3])
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics
+}
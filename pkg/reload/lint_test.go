@@ -0,0 +1,64 @@
+package reload
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	output := "# example.com/app\r\n" +
+		"vet: main.go:3:1: unreachable code\r\n" +
+		"  pkg/server/server.go:12: error strings should not be capitalized\n" +
+		"exit status 1\n"
+
+	got := ParseDiagnostics("go vet ./...", output)
+	want := []event.Diagnostic{
+		{Command: "go vet ./...", File: "main.go", Line: 3, Column: 1, Message: "unreachable code"},
+		{Command: "go vet ./...", File: "pkg/server/server.go", Line: 12, Message: "error strings should not be capitalized"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLintGate(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Lint.Mode = configuration.LintGate
+	cfg.Lint.Commands = []string{"echo 'main.go:3:1: unreachable code'; exit 1"}
+
+	bus := event.NewBus()
+	defer bus.Close()
+	subscription := bus.Subscribe()
+	defer subscription.Close()
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Events = bus
+
+	if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if reloader.Running() {
+		t.Error("binary started despite lint findings")
+	}
+
+	select {
+	case ev := <-subscription.Events():
+		finished, ok := ev.(event.LintFinished)
+		if !ok {
+			t.Fatalf("got %T, want the lint to finish before anything else", ev)
+		}
+		if !finished.Blocked || len(finished.Diagnostics) != 1 || finished.Diagnostics[0].Line != 3 {
+			t.Errorf("got %+v, want a single blocking diagnostic at line 3", finished)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lint did not finish")
+	}
+}
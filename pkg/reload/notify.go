@@ -0,0 +1,98 @@
+package reload
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+)
+
+// notify creates the notify socket of the binary about to start if the notify ready check is configured
+func (r *Reload) notify() error {
+	r.closeNotifier()
+	if r.config.Build.ReadyCheck != configuration.ReadyCheckNotify {
+		return nil
+	}
+	n, err := newNotifier()
+	if err != nil {
+		return err
+	}
+	r.notifier = n
+	return nil
+}
+
+// closeNotifier stops receiving notifications, once the binary is ready or did not get ready
+func (r *Reload) closeNotifier() {
+	if err := r.notifier.Close(); err != nil {
+		r.logger.Main("error: during notify socket removal: %s", err)
+	}
+	r.notifier = nil
+}
+
+// notifyMessageSize is the size of the largest notification read, systemd accepts no larger ones either
+const notifyMessageSize = 4096
+
+// notifier is the socket a single binary is told to notify about its readiness in NOTIFY_SOCKET,
+// so that its notification cannot be mistaken for the one of another binary
+type notifier struct {
+	dir  string
+	conn *net.UnixConn
+	// ready is closed once READY=1 was received
+	ready chan struct{}
+}
+
+// newNotifier creates a notify socket in a directory of its own and receives on it until it is closed
+func newNotifier() (*notifier, error) {
+	dir, err := os.MkdirTemp("", "gomon-notify-")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	n := &notifier{dir: dir, conn: conn, ready: make(chan struct{})}
+	go n.receive()
+	return n, nil
+}
+
+// receive reads the notifications until one tells that the binary is ready or the socket is closed
+func (n *notifier) receive() {
+	buf := make([]byte, notifyMessageSize)
+	for {
+		size, err := n.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		// a notification holds one assignment per line, like READY=1\nSTATUS=serving
+		for _, line := range bytes.Split(buf[:size], []byte("\n")) {
+			if string(line) == "READY=1" {
+				close(n.ready)
+				return
+			}
+		}
+	}
+}
+
+// env tells the binary where to notify
+func (n *notifier) env() []string {
+	if n == nil {
+		return nil
+	}
+	return []string{"NOTIFY_SOCKET=" + n.conn.LocalAddr().String()}
+}
+
+// Close stops receiving and removes the socket, a notification sent later fails
+func (n *notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	if rmErr := os.RemoveAll(n.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -1,75 +1,169 @@
 package reload
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
 	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
+// Builder builds the binary, writing the build output to out. The build is aborted when the context is done.
+type Builder interface {
+	Build(ctx context.Context, out io.Writer) error
+}
+
+// Runner starts the built binary, writing its output to stdout and stderr
+type Runner interface {
+	Run(stdout io.Writer, stderr io.Writer) (Process, error)
+}
+
+// Process is a binary started by a Runner
+type Process interface {
+	Pid() int
+	Kill() error
+	// Wait blocks until the process exited and returns its exit code
+	Wait() (int, error)
+}
+
 // Reload recompiles the build and restarts the binary
 type Reload struct {
 	config *configuration.Configuration
 	logger *logging.Logger
 	mu     sync.RWMutex
 
-	running         bool
-	startBuilding   chan bool
-	stop            chan bool
-	stopRunning     chan bool
-	FinishedRunning chan bool
-	FinishedKilling chan bool
+	// Builder builds the binary, by default with the configured build command
+	Builder Builder
+	// Runner runs the binary, by default with the configured execution command
+	Runner Runner
+	// Events receives the build and run events, they are dropped if it is nil
+	Events *event.Bus
+	// Checksums are the checksums of the watched files, builds are only cached if they are set
+	Checksums *utils.FileChecksums
+
+	process Process
+	// exited is closed once the process exited
+	exited chan struct{}
+	// listener is passed to every binary started, it is nil until the first start or if none is configured
+	listener *os.File
+	// notifier receives the readiness of the binary started last until it is ready, nil unless the notify
+	// ready check is configured
+	notifier *notifier
+	// cycle is the timing of the Run in progress
+	cycle event.Timing
 }
 
 // NewReload creates a new Reload with the config provided
 func NewReload(cfg *configuration.Configuration, l *logging.Logger) *Reload {
-	return &Reload{
-		config:          cfg,
-		logger:          l,
-		running:         false,
-		startBuilding:   make(chan bool, 1),
-		stop:            make(chan bool, 1),
-		stopRunning:     make(chan bool),
-		FinishedRunning: make(chan bool, 1),
-		FinishedKilling: make(chan bool, 1),
+	r := &Reload{
+		config: cfg,
+		logger: l,
 	}
+	r.Builder = &cmdBuilder{reload: r}
+	r.Runner = &cmdRunner{reload: r}
+	return r
 }
 
-// Cleanup stops the current build and the run
-func (r *Reload) Cleanup() {
-	r.BuildCleanup()
-	r.RunCleanup()
+// Running reports whether the binary is currently running
+func (r *Reload) Running() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.process == nil {
+		return false
+	}
+	select {
+	case <-r.exited:
+		return false
+	default:
+		return true
+	}
 }
 
-// Run cleans up and starts the new build
-func (r *Reload) Run() {
-	r.Cleanup()
-	go r.start()
+// Run stops the binary, rebuilds and restarts it. It returns once the new binary was started, the build failed
+// or the context is done, which aborts the build. In the start_first restart mode the binary keeps running until
+// the new one is ready. A failed build is published as BuildFinished and is no error,
+// the error returned is about the previous binary which could not be stopped.
+// In the lint gate mode findings keep the previous binary running, in the advisory mode lint runs after the restart.
+// Detected is when the changes the binary is rebuilt for were detected, zero for the first build, the stages
+// following it are timed and published with AppStarted.
+func (r *Reload) Run(ctx context.Context, detected time.Time) error {
+	r.cycle = event.Timing{Detected: detected}
+	isGate := r.config.Lint.Mode == configuration.LintGate
+	if isGate && (r.lint(ctx) || ctx.Err() != nil) {
+		return nil
+	}
+
+	isRestarted, err := r.restart(ctx)
+	if err != nil {
+		return err
+	}
+	if isRestarted && !isGate {
+		r.lint(ctx)
+	}
+	return nil
 }
 
-func (r *Reload) start() {
-	r.startBuilding <- true
-	defer func() {
-		<-r.startBuilding
-	}()
+// restart replaces the binary with a new build, stopping it first unless the start_first mode is configured.
+// Debugging always stops first, as two debuggers cannot accept clients on the same port. It reports whether
+// the new binary is running.
+func (r *Reload) restart(ctx context.Context) (bool, error) {
+	if r.config.Build.Restart == configuration.RestartStartFirst && !r.config.Debug {
+		return r.overlap(ctx)
+	}
 
-	select {
-	case <-r.stop:
-		return
-	default:
+	if err := r.Stop(); err != nil {
+		return false, err
+	}
+	if !r.rebuild(ctx) {
+		return false, nil
 	}
-	if err := r.build(); err != nil {
-		r.logger.Main("error: during build: %s", err)
-		r.FinishedRunning <- false
-		return
+	if err := r.run(ctx); err != nil {
+		r.logger.Run("error: during run: %s", err)
+		return false, nil
 	}
-	r.logger.Build("%s", "finished building")
+	return true, nil
+}
 
-	select {
-	case <-r.stop:
-		return
-	default:
+// rebuild builds the binary, unless a cached build of the same sources can be reused, and reports whether it succeeded
+func (r *Reload) rebuild(ctx context.Context) bool {
+	start := time.Now()
+	r.Events.Publish(event.BuildStarted{At: start})
+	if !r.cycle.Detected.IsZero() {
+		r.cycle.Wait = start.Sub(r.cycle.Detected)
+	}
+	key, isCached := r.cacheKey()
+	if isCached {
+		reused, err := r.reuse(key)
+		if err != nil {
+			r.logger.Main("error: during build cache lookup: %s", err)
+		}
+		if reused {
+			r.cycle.Build = time.Since(start)
+			r.Events.Publish(event.BuildFinished{At: time.Now(), Duration: r.cycle.Build, Cached: true})
+			return true
+		}
 	}
 
-	r.run()
+	var output bytes.Buffer
+	err := r.build(ctx, &output)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	r.cycle.Build = time.Since(start)
+	r.Events.Publish(event.BuildFinished{At: time.Now(), Duration: r.cycle.Build, Err: err, Output: output.String()})
+	if err != nil {
+		return false
+	}
+	if isCached {
+		if err := r.store(key); err != nil {
+			r.logger.Main("error: during build caching: %s", err)
+		}
+	}
+	return true
 }
@@ -1,19 +1,27 @@
 package reload
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
 	"github.com/AlexanderBrese/gomon/pkg/logging"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
+	"go.uber.org/goleak"
 )
 
 const checkReloadDelay = 600
 
 func TestReload(t *testing.T) {
+	defer goleak.VerifyNone(t)
 	cfg, err := configuration.TestConfiguration()
 	cfg.Build.RelSrcDir = "cmd/web"
 
@@ -29,20 +37,21 @@ func TestReload(t *testing.T) {
 
 	defer func() {
 		if err := runCleanup(reloader); err != nil {
-			// TODO: log
-			return
+			t.Error(err)
 		}
 	}()
 
-	reloadStart(reloader)
+	if err := reloadStart(reloader); err != nil {
+		t.Error(err)
+	}
 	time.Sleep(checkReloadDelay * time.Millisecond)
 	if err := reloadPassed(reloader); err != nil {
 		t.Error(err)
 	}
 }
 
-func reloadStart(reloader *Reload) {
-	reloader.Run()
+func reloadStart(reloader *Reload) error {
+	return reloader.Run(context.Background(), time.Time{})
 }
 
 func reloadPassed(reloader *Reload) error {
@@ -53,10 +62,115 @@ func reloadPassed(reloader *Reload) error {
 	if err := utils.CheckPath(binary); err != nil {
 		return fmt.Errorf("error: there was no built binary found at %s", binary)
 	}
-	return utils.WithLockAndError(&reloader.mu, func() error {
-		if !reloader.running {
-			return errors.New("error: binary not running")
+	if !reloader.Running() {
+		return errors.New("error: binary not running")
+	}
+	return nil
+}
+
+// slowBuilder takes its time for every build
+type slowBuilder struct {
+	countingBuilder
+	duration time.Duration
+}
+
+func (b *slowBuilder) Build(ctx context.Context, out io.Writer) error {
+	time.Sleep(b.duration)
+	return b.countingBuilder.Build(ctx, out)
+}
+
+func TestRunTiming(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildDir, err := cfg.BuildDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CreateBuildDirIfNotExist(buildDir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
 		}
-		return nil
-	})
+	}()
+	bus := event.NewBus()
+	defer bus.Close()
+	events := bus.Subscribe()
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Builder = &slowBuilder{countingBuilder: countingBuilder{cfg: cfg}, duration: 50 * time.Millisecond}
+	reloader.Runner = idleRunner{}
+	reloader.Events = bus
+	defer func() {
+		if err := reloader.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	detected := time.Now().Add(-100 * time.Millisecond)
+	if err := reloader.Run(context.Background(), detected); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case ev := <-events.Events():
+			started, ok := ev.(event.AppStarted)
+			if !ok {
+				continue
+			}
+			timing := started.Timing
+			if !timing.Detected.Equal(detected) || timing.Wait < 100*time.Millisecond || timing.Build < 50*time.Millisecond {
+				t.Errorf("got %+v, want the wait and build timed from the detection", timing)
+			}
+			if timing.Ready {
+				t.Errorf("got %+v, want the startup to be the spawn time without a ready check", timing)
+			}
+			return
+		default:
+			t.Fatal("the binary was not started")
+		}
+	}
+}
+
+func TestRunTimingUntilReady(t *testing.T) {
+	// the binary gets ready a while after it was started
+	readyAt := time.Now().Add(time.Hour)
+	var mu sync.Mutex
+	ready := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Now().Before(readyAt) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ready.Close()
+	for _, restart := range configuration.RestartModes {
+		reloader := startFirstReload(t, ready.URL)
+		reloader.config.Build.Restart = restart
+		bus := event.NewBus()
+		events := bus.Subscribe()
+		reloader.Events = bus
+
+		mu.Lock()
+		readyAt = time.Now().Add(100 * time.Millisecond)
+		mu.Unlock()
+		if err := reloader.Run(context.Background(), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		bus.Close()
+		var timing *event.Timing
+		for ev := range events.Events() {
+			if started, ok := ev.(event.AppStarted); ok {
+				timing = &started.Timing
+			}
+		}
+		if timing == nil {
+			t.Fatalf("%s: the binary was not started", restart)
+		}
+		if !timing.Ready || timing.Startup < 100*time.Millisecond {
+			t.Errorf("%s: got %+v, want the startup timed until the binary was ready", restart, *timing)
+		}
+	}
 }
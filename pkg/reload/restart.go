@@ -0,0 +1,140 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// readyInterval is how often the readiness of the new binary is checked
+	readyInterval = 50 * time.Millisecond
+	// readyCheckTimeout is how long a single readiness check may take
+	readyCheckTimeout = time.Second
+	// startGrace is how long the new binary has to keep running to be ready without a ready check,
+	// which catches one failing right away, e.g. as the previous binary holds its port
+	startGrace = 200 * time.Millisecond
+)
+
+// overlap builds while the binary keeps running, then starts the new binary and stops the previous one once
+// the new one is ready. A new binary failing to get ready is stopped instead and the previous one kept.
+// It reports whether the new binary is running.
+func (r *Reload) overlap(ctx context.Context) (bool, error) {
+	if !r.rebuild(ctx) {
+		return false, nil
+	}
+
+	r.mu.RLock()
+	isFirst := r.process == nil
+	r.mu.RUnlock()
+	if isFirst && r.config.Listen.Address == "" {
+		r.logger.Main("%s", "start_first without listen.address: a binary binding a port cannot start while the previous one holds it")
+	}
+
+	started := time.Now()
+	process, exited, err := r.start()
+	if err != nil {
+		r.logger.Run("error: during run: %s", err)
+		return false, nil
+	}
+	if err := r.awaitStart(ctx, exited); err != nil {
+		if ctx.Err() != nil {
+			return false, kill(process, exited)
+		}
+		r.logger.Main("error: the new binary did not get ready, keeping the previous one: %s", err)
+		return false, kill(process, exited)
+	}
+
+	r.mu.Lock()
+	previous, previousExited := r.process, r.exited
+	r.mu.Unlock()
+	r.adopt(process, exited, started, r.config.Build.ReadyCheck != "")
+	if previous == nil {
+		return true, nil
+	}
+	return true, kill(previous, previousExited)
+}
+
+// awaitStart waits until the new binary is ready, or without a ready check until it kept running for a moment
+func (r *Reload) awaitStart(ctx context.Context, exited <-chan struct{}) error {
+	if r.config.Build.ReadyCheck != "" {
+		return r.awaitReady(ctx, exited)
+	}
+	select {
+	case <-exited:
+		return errors.New("exited right after it started")
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(startGrace):
+		return nil
+	}
+}
+
+// awaitReady waits until the ready check passes, the new binary exited, the ready timeout passed or the context is done.
+// With the notify check it waits for the notification of the binary started last.
+func (r *Reload) awaitReady(ctx context.Context, exited <-chan struct{}) error {
+	check := r.config.Build.ReadyCheck
+	if check == "" {
+		return nil
+	}
+	var notified <-chan struct{}
+	if r.notifier != nil {
+		notified = r.notifier.ready
+		defer r.closeNotifier()
+	}
+	timeout := time.NewTimer(r.config.ReadyTimeout())
+	defer timeout.Stop()
+	ticker := time.NewTicker(readyInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-exited:
+			return errors.New("exited before it was ready")
+		default:
+		}
+		if notified == nil && isReady(ctx, check) {
+			return nil
+		}
+		select {
+		case <-notified:
+			return nil
+		case <-exited:
+			return errors.New("exited before it was ready")
+		case <-timeout.C:
+			return fmt.Errorf("not ready within %s", r.config.ReadyTimeout())
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// isReady checks if the http(s) URL responds without a server error or the tcp address accepts connections
+func isReady(ctx context.Context, check string) bool {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	if strings.HasPrefix(check, "http://") || strings.HasPrefix(check, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, check, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode < http.StatusInternalServerError
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", strings.TrimPrefix(check, "tcp://"))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
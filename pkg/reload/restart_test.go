@@ -0,0 +1,182 @@
+package reload
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+func TestStartFirst(t *testing.T) {
+	ready := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ready.Close()
+	reloader := startFirstReload(t, ready.URL)
+
+	previous := runStartFirst(t, reloader)
+	current := runStartFirst(t, reloader)
+	if previous == current {
+		t.Fatal("the binary was not replaced")
+	}
+	expectKilled(t, previous, true)
+	expectKilled(t, current, false)
+}
+
+func TestStartFirstNotReady(t *testing.T) {
+	// nothing accepts connections at the address of a closed listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	reloader := startFirstReload(t, "")
+
+	previous := runStartFirst(t, reloader)
+	reloader.config.Build.ReadyCheck = "tcp://" + addr
+	reloader.config.Build.ReadyTimeout = 200
+	if current := runStartFirst(t, reloader); current != previous {
+		t.Fatal("a binary that did not get ready replaced the previous one")
+	}
+	expectKilled(t, previous, false)
+}
+
+// notifyingRunner starts idle processes which notify their readiness to the notify socket of the reloader,
+// like a binary would to the one in its NOTIFY_SOCKET
+type notifyingRunner struct {
+	reload *Reload
+	// notifies tells whether the next process notifies
+	notifies bool
+}
+
+func (rn *notifyingRunner) Run(stdout io.Writer, stderr io.Writer) (Process, error) {
+	if rn.notifies {
+		env := rn.reload.notifier.env()
+		socket := strings.TrimPrefix(env[0], "NOTIFY_SOCKET=")
+		conn, err := net.Dial("unixgram", socket)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte("STATUS=serving\nREADY=1")); err != nil {
+			return nil, err
+		}
+	}
+	return &idleProcess{killed: make(chan struct{})}, nil
+}
+
+func TestStartFirstNotify(t *testing.T) {
+	reloader := startFirstReload(t, configuration.ReadyCheckNotify)
+	reloader.config.Build.ReadyTimeout = 200
+	runner := &notifyingRunner{reload: reloader, notifies: true}
+	reloader.Runner = runner
+
+	previous := runStartFirst(t, reloader)
+	runner.notifies = false
+	if current := runStartFirst(t, reloader); current != previous {
+		t.Fatal("a binary that did not notify replaced the previous one")
+	}
+	expectKilled(t, previous, false)
+
+	runner.notifies = true
+	if current := runStartFirst(t, reloader); current == previous {
+		t.Fatal("a binary that notified did not replace the previous one")
+	}
+	expectKilled(t, previous, true)
+	if reloader.notifier != nil {
+		t.Error("the notify socket was kept once the binary was ready")
+	}
+}
+
+// exitingRunner starts processes which exit right away, like a binary failing to bind its port
+type exitingRunner struct{}
+
+func (exitingRunner) Run(stdout io.Writer, stderr io.Writer) (Process, error) {
+	return exitedProcess{}, nil
+}
+
+type exitedProcess struct{}
+
+func (exitedProcess) Pid() int { return 43 }
+
+func (exitedProcess) Kill() error { return nil }
+
+func (exitedProcess) Wait() (int, error) { return 1, nil }
+
+func TestStartFirstExitsRightAway(t *testing.T) {
+	reloader := startFirstReload(t, "")
+
+	previous := runStartFirst(t, reloader)
+	reloader.Runner = exitingRunner{}
+	if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	reloader.mu.RLock()
+	current := reloader.process
+	reloader.mu.RUnlock()
+	if current != previous {
+		t.Fatal("a binary that exited right away replaced the previous one")
+	}
+	expectKilled(t, previous, false)
+}
+
+// startFirstReload creates a Reload in the start_first mode with fakes for building and running
+func startFirstReload(t *testing.T, readyCheck string) *Reload {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Build.Restart = configuration.RestartStartFirst
+	cfg.Build.ReadyCheck = readyCheck
+	buildDir, err := cfg.BuildDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.CreateBuildDirIfNotExist(buildDir); err != nil {
+		t.Fatal(err)
+	}
+
+	reloader := NewReload(cfg, logging.NewLogger(cfg))
+	reloader.Builder = &countingBuilder{cfg: cfg}
+	reloader.Runner = idleRunner{}
+	t.Cleanup(func() {
+		if err := reloader.Stop(); err != nil {
+			t.Error(err)
+		}
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	})
+	return reloader
+}
+
+// runStartFirst reloads and returns the process running afterwards
+func runStartFirst(t *testing.T, reloader *Reload) *idleProcess {
+	if err := reloader.Run(context.Background(), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+	return reloader.process.(*idleProcess)
+}
+
+func expectKilled(t *testing.T, p *idleProcess, want bool) {
+	t.Helper()
+	select {
+	case <-p.killed:
+		if !want {
+			t.Error("the binary was killed")
+		}
+	default:
+		if want {
+			t.Error("the binary was not killed")
+		}
+	}
+}
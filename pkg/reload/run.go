@@ -1,43 +1,148 @@
 package reload
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"os/exec"
+	"time"
 
+	"github.com/AlexanderBrese/gomon/pkg/event"
 	"github.com/AlexanderBrese/gomon/pkg/logging"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
-// RunCleanup stops the run
-func (r *Reload) RunCleanup() {
-	utils.WithLock(&r.mu, func() {
-		if r.running {
-			r.stopRunning <- true
-		}
-	})
+// exitTimeout is how long a process may take to be reaped after it could not be killed because it already exited
+const exitTimeout = 100 * time.Millisecond
+
+// cmdRunner runs the configured execution command
+type cmdRunner struct {
+	reload *Reload
 }
 
-func (r *Reload) run() {
-	cmd, stdout, stderr, err := r.StartCmd(r.config.Build.ExecutionCommand)
+func (rn *cmdRunner) Run(stdout io.Writer, stderr io.Writer) (Process, error) {
+	if rn.reload.config.Debug {
+		return rn.debug(stdout, stderr)
+	}
+	listeners, err := rn.reload.listeners()
 	if err != nil {
-		r.logger.Run("error: during run: %s", err)
-		return
+		return nil, err
+	}
+	cmd, cmdStdout, cmdStderr, err := rn.reload.startExecution(listeners)
+	if err != nil {
+		return nil, err
 	}
 
-	r.FinishedRunning <- true
-	r.logger.Run("%s", "running")
-	utils.WithLock(&r.mu, func() {
-		r.running = true
-	})
-
+	p := &cmdProcess{reload: rn.reload, cmd: cmd, done: make(chan struct{})}
 	go func() {
-		_, _ = io.Copy(&logging.RunWriter{Logger: r.logger}, stdout)
-		_, _ = io.Copy(&logging.ErrorWriter{Logger: r.logger}, stderr)
+		_, _ = io.Copy(stdout, cmdStdout)
+		_, _ = io.Copy(stderr, cmdStderr)
+		cmdStdout.Close()
+		cmdStderr.Close()
 	}()
+	go p.wait()
+	return p, nil
+}
+
+// cmdProcess is a process started by the cmdRunner
+type cmdProcess struct {
+	reload *Reload
+	cmd    *exec.Cmd
+
+	// done is closed once the process exited and err is set
+	done chan struct{}
+	err  error
+}
+
+func (p *cmdProcess) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+func (p *cmdProcess) Kill() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	if _, err := p.reload.KillCmd(p.cmd); err != nil {
+		// the process may have exited on its own in the meantime
+		select {
+		case <-p.done:
+			return nil
+		case <-time.After(exitTimeout):
+			return err
+		}
+	}
+	<-p.done
+	return nil
+}
+
+func (p *cmdProcess) Wait() (int, error) {
+	<-p.done
+	var exitErr *exec.ExitError
+	if p.err != nil && !errors.As(p.err, &exitErr) {
+		return -1, p.err
+	}
+	return p.cmd.ProcessState.ExitCode(), nil
+}
+
+// wait is the only one waiting for the process, so that its exit code is not lost
+func (p *cmdProcess) wait() {
+	p.err = p.cmd.Wait()
+	close(p.done)
+}
+
+// run starts the binary and waits until it is ready if a ready check is configured, a binary not getting ready
+// keeps running nonetheless
+func (r *Reload) run(ctx context.Context) error {
+	started := time.Now()
+	process, exited, err := r.start()
+	if err != nil {
+		return err
+	}
+	isReady := false
+	if r.config.Build.ReadyCheck != "" {
+		err := r.awaitReady(ctx, exited)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Main("error: the binary did not get ready: %s", err)
+		}
+		isReady = err == nil
+	}
+	r.adopt(process, exited, started, isReady)
+	return nil
+}
+
+// start starts the binary and follows it until it exited, which closes the channel returned
+func (r *Reload) start() (Process, chan struct{}, error) {
+	if err := r.notify(); err != nil {
+		return nil, nil, fmt.Errorf("during notify socket creation: %w", err)
+	}
+	process, err := r.Runner.Run(&logging.RunWriter{Logger: r.logger}, &logging.ErrorWriter{Logger: r.logger})
+	if err != nil {
+		r.closeNotifier()
+		return nil, nil, err
+	}
 
+	exited := make(chan struct{})
 	go func() {
-		if err := r.kill(cmd, stdout, stderr); err != nil {
-			r.logger.Run("error: during kill: %s", err)
-			return
+		defer close(exited)
+		code, err := process.Wait()
+		if err != nil {
+			r.logger.Run("error: during run: %s", err)
 		}
+		r.Events.Publish(event.AppExited{At: time.Now(), Pid: process.Pid(), Code: code})
 	}()
+	return process, exited, nil
+}
+
+// adopt makes the binary started at the time provided the running one, isReady tells that its ready check passed
+func (r *Reload) adopt(process Process, exited chan struct{}, started time.Time, isReady bool) {
+	utils.WithLock(&r.mu, func() {
+		r.process = process
+		r.exited = exited
+	})
+	r.cycle.Startup = time.Since(started)
+	r.cycle.Ready = isReady
+	r.Events.Publish(event.AppStarted{At: time.Now(), Pid: process.Pid(), Timing: r.cycle})
 }
@@ -1,8 +1,10 @@
 package reload
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -46,11 +48,10 @@ func TestRun(t *testing.T) {
 }
 
 func runStart(reloader *Reload) error {
-	if err := reloader.build(); err != nil {
+	if err := reloader.build(context.Background(), io.Discard); err != nil {
 		return err
 	}
-	reloader.run()
-	return nil
+	return reloader.run(context.Background())
 }
 
 func runPassed(reloader *Reload) error {
@@ -61,20 +62,15 @@ func runPassed(reloader *Reload) error {
 	if err := utils.CheckPath(binary); err != nil {
 		return fmt.Errorf("error: there was no built binary found at %s", binary)
 	}
-	return utils.WithLockAndError(&reloader.mu, func() error {
-		if !reloader.running {
-			return errors.New("error: binary not running")
-		}
-		return nil
-	})
+	if !reloader.Running() {
+		return errors.New("error: binary not running")
+	}
+	return nil
 }
 
 func runCleanup(reloader *Reload) error {
-	if err := buildCleanup(reloader); err != nil {
+	if err := reloader.Stop(); err != nil {
 		return err
 	}
-
-	reloader.RunCleanup()
-
-	return nil
+	return buildCleanup(reloader)
 }
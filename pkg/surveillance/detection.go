@@ -1,40 +1,85 @@
 package surveillance
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sync/errgroup"
 )
 
+// gitCheckInterval is how often git is checked at most while changes are held back for it
+const gitCheckInterval = 100 * time.Millisecond
+
 type Detection struct {
-	environment  *Environment
-	notification *Notification
-	checksums    *utils.FileChecksums
-	filter       *Filter
+	environment *Environment
+	checksums   *utils.FileChecksums
+	filter      *Filter
+	// dirs are the watched directories, so that removed and renamed subtrees can be unwatched without a stat
+	dirs map[string]bool
+	// gitDir is checked for locks and operations in progress, which the changes are held back for
+	gitDir string
+	// held are the changes held back until git finished, settle fires once it might have.
+	// gitFinished is whether git was found finished after the last change.
+	held        *changes
+	settle      <-chan time.Time
+	gitFinished bool
 }
 
-func NewDetection(env *Environment, n *Notification) (*Detection, error) {
+func NewDetection(env *Environment) (*Detection, error) {
+	roots, err := env.config.WatchRoots()
+	if err != nil {
+		return nil, fmt.Errorf("during watch roots lookup: %w", err)
+	}
 	d := &Detection{
-		environment:  env,
-		notification: n,
-		filter:       NewFilter(env.config),
-		checksums:    utils.NewFileChecksums(),
+		environment: env,
+		filter:      NewFilter(env.config, roots...),
+		checksums:   utils.NewFileChecksums(),
+		dirs:        make(map[string]bool),
+		gitDir:      filepath.Join(env.config.Root, ".git"),
 	}
 
-	if err := d.observe(env.config.Root); err != nil {
+	if env.config.Watch.ChecksumCache {
+		if err := d.restoreChecksums(); err != nil {
+			env.logger.Main("error: during checksum restoration, hashing every file: %s", err)
+		}
+	}
+	if err := d.observe(env.config.Root, nil); err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		if err := d.observe(root, nil); err != nil {
+			return nil, err
+		}
+		env.logger.Main("watching %s as well", root)
+	}
+	if err := d.observeConfiguration(); err != nil {
 		return nil, err
 	}
+	if env.reloader != nil {
+		env.reloader.Checksums = d.checksums
+	}
 
 	return d, nil
 }
 
-func (d *Detection) Run() error {
+// Run detects changes until the context is done or watching fails
+func (d *Detection) Run(ctx context.Context) error {
+	if d.environment.config.Watch.ChecksumCache {
+		defer d.saveChecksums()
+	}
 	for {
 		select {
-		case <-d.environment.stopDetecting:
-			close(d.environment.stopDetecting)
+		case <-ctx.Done():
 			return nil
 		case evs, ok := <-d.environment.detector.Events:
 			if !ok {
@@ -48,47 +93,119 @@ func (d *Detection) Run() error {
 				return nil
 			}
 			return errs[len(errs)-1]
+		case <-d.settle:
+			d.release()
 		}
 	}
 }
 
-func (d *Detection) observe(root string) error {
-	return filepath.WalkDir(root, func(path string, e os.DirEntry, err error) error {
+// restoreChecksums reads the checksums of the previous run, so that unchanged files need not be hashed
+func (d *Detection) restoreChecksums() error {
+	path, err := d.environment.config.ChecksumCachePath()
+	if err != nil {
+		return err
+	}
+	return d.checksums.Restore(path)
+}
+
+func (d *Detection) saveChecksums() {
+	path, err := d.environment.config.ChecksumCachePath()
+	if err == nil {
+		err = d.checksums.Save(path)
+	}
+	if err != nil {
+		d.environment.logger.Main("error: during checksum saving: %s", err)
+	}
+}
+
+// observe watches the included directories of the tree at root and caches its files. The files of a tree
+// created at runtime are changes, they are added to changed if provided. Paths vanishing during the walk,
+// e.g. during a branch switch, are skipped.
+func (d *Detection) observe(root string, changed *changes) error {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, e os.DirEntry, err error) error {
 		if err != nil {
+			if changed != nil && errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
 			return err
 		}
 
 		isFile := !e.IsDir()
 		if isFile {
-			return d.cacheFile(path)
+			files = append(files, path)
+			return nil
 		}
 
 		return d.addIfIncluded(path)
 	})
-}
+	if err != nil {
+		return err
+	}
 
-func (d *Detection) cacheFile(path string) error {
-	isExcluded, err := d.filter.IsExcludedFile(path)
+	hasChanged, err := d.cacheFiles(files)
 	if err != nil {
 		return err
 	}
-	if !isExcluded {
-		newChecksum, err := utils.FileChecksum(path)
-		if err != nil {
-			return err
+	if changed != nil {
+		for i, path := range files {
+			if hasChanged[i] {
+				changed.add(path, fsnotify.Create)
+			}
 		}
-		d.checksums.UpdateFileChecksum(path, newChecksum)
 	}
+	return nil
+}
+
+// cacheFiles caches the files in parallel, as hashing the whole tree is what makes the startup slow
+func (d *Detection) cacheFiles(files []string) ([]bool, error) {
+	hasChanged := make([]bool, len(files))
+	var g errgroup.Group
+	g.SetLimit(runtime.NumCPU())
+	for i, path := range files {
+		i, path := i, path
+		g.Go(func() error {
+			changed, err := d.cacheFile(path)
+			hasChanged[i] = changed
+			return err
+		})
+	}
+	return hasChanged, g.Wait()
+}
 
+// observeConfiguration watches the configuration files in use so that edits can be applied at runtime
+func (d *Detection) observeConfiguration() error {
+	for _, layer := range d.environment.config.Layers {
+		if err := d.add(layer); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (d *Detection) add(path string) error {
-	return d.environment.detector.Add(path)
+// cacheFile stores the checksum of the file unless it is excluded or outside the included directories
+// and reports whether it changed
+func (d *Detection) cacheFile(path string) (bool, error) {
+	isExcluded, err := d.filter.IsExcludedFile(path)
+	if err != nil {
+		return false, err
+	}
+	isIncluded, err := d.filter.IsIncludedDir(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	if isExcluded || !isIncluded {
+		return false, nil
+	}
+	hasChanged, err := d.checksums.Update(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return hasChanged, err
 }
 
-func (d *Detection) remove(path string) error {
-	return d.environment.detector.Remove(path)
+func (d *Detection) add(path string) error {
+	return d.environment.detector.Add(path)
 }
 
 func (d *Detection) addIfIncluded(path string) error {
@@ -103,82 +220,225 @@ func (d *Detection) addIfIncluded(path string) error {
 	if err != nil {
 		return err
 	}
-	if isIncluded {
+	if !isIncluded {
+		// files of the directory are not included, creating an included directory in it is a change though
+		isIncluded, err = d.filter.IsAboveIncludedDir(path)
+		if err != nil {
+			return err
+		}
+	}
+	if isIncluded && !d.dirs[path] {
 		if err := d.add(path); err != nil {
 			return err
 		}
+		d.dirs[path] = true
 	}
 	return nil
 }
 
 func (d *Detection) on(evs []fsnotify.Event) error {
-	hasChanged := false
-	hasFiles := false
+	changed := newChanges()
+	changed.Detected = time.Now()
+	var removed []string
+	hasReconfigured := false
 
 	for _, ev := range evs {
 		path := ev.Name
 
-		isDir, err := utils.IsDir(path)
+		if d.isConfiguration(path) {
+			hasReconfigured = true
+			continue
+		}
+
+		// the path is gone, stating it would fail. Whether its files changed is only known at the end
+		// of the batch, since editors saving atomically replace the file right away.
+		if utils.IsRemove(ev) || utils.IsRename(ev) {
+			d.unobserve(path)
+			removed = append(removed, path)
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// removed again before the batch was handled
+			continue
+		}
 		if err != nil {
 			return err
 		}
-		if isDir {
-			if err := d.dirChange(ev, path); err != nil {
-				return err
-			}
-		} else {
-			hasFiles = true
-			if !hasChanged {
-				changeDetected, err := d.fileChange(ev, path)
-				if err != nil {
+		if info.IsDir() {
+			if utils.IsCreate(ev) {
+				if err := d.observe(path, changed); err != nil {
 					return err
 				}
-				if changeDetected {
-					hasChanged = true
-				}
 			}
+			continue
+		}
+
+		changeDetected, err := d.fileChange(ev, path)
+		if err != nil {
+			return err
+		}
+		if changeDetected {
+			changed.add(path, ev.Op)
 		}
 	}
 
-	if hasFiles {
-		if hasChanged {
-			d.notification.NotfiyChange()
-		} else {
-			d.notification.NotifyNoChange()
+	for _, path := range removed {
+		if err := d.removal(path, changed); err != nil {
+			return err
 		}
 	}
 
+	if hasReconfigured {
+		d.reconfigure()
+	}
+
+	d.publish(changed)
 	return nil
 }
-func (d *Detection) fileChange(ev fsnotify.Event, path string) (bool, error) {
-	isExcluded, err := d.filter.IsExcludedFile(path)
-	if err != nil {
-		return false, err
+
+// publish hands the changes over unless git is in the middle of an operation, like a checkout or rebase.
+// Then they are held back, together with those following, until git finished and nothing changed for a while.
+func (d *Detection) publish(changed *changes) {
+	if d.held == nil && len(changed.Paths) == 0 {
+		return
+	}
+	if d.held == nil && !d.isGitBusy() {
+		changed.At = time.Now()
+		d.environment.events.Publish(changed.FilesChanged)
+		return
 	}
+	if d.held == nil {
+		d.environment.logger.Main("%s", "git is busy, waiting for it to finish")
+		d.held = newChanges()
+	}
+	d.held.merge(changed)
+	d.gitFinished = false
+	d.settle = d.settleAfter()
+}
 
-	if !utils.IsWrite(ev) || isExcluded {
-		return false, nil
+// release publishes the changes held back once git finished and nothing changed since,
+// as the last changes of git may still be debounced when it finished
+func (d *Detection) release() {
+	wasFinished := d.gitFinished
+	d.gitFinished = !d.isGitBusy()
+	if !wasFinished || !d.gitFinished {
+		d.settle = d.settleAfter()
+		return
 	}
-	newChecksum, err := utils.FileChecksum(path)
-	if err != nil {
-		return false, err
+	held := d.held
+	d.held, d.settle, d.gitFinished = nil, nil, false
+	d.publish(held)
+}
+
+// settleAfter fires once the changes held back may be released, git is not checked more often than every gitCheckInterval
+func (d *Detection) settleAfter() <-chan time.Time {
+	wait := d.environment.config.SettleTime()
+	if wait < gitCheckInterval {
+		wait = gitCheckInterval
 	}
-	if d.checksums.HasChanged(path, newChecksum) {
-		d.checksums.UpdateFileChecksum(path, newChecksum)
-		return true, nil
+	return time.After(wait)
+}
+
+// isGitBusy checks if git holds the index lock or is in the middle of a rebase
+func (d *Detection) isGitBusy() bool {
+	for _, name := range []string{"index.lock", "rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(d.gitDir, name)); err == nil {
+			return true
+		}
 	}
-	return false, nil
+	return false
 }
 
-func (d *Detection) dirChange(ev fsnotify.Event, path string) error {
-	if utils.IsRemove(ev) {
-		if err := d.remove(path); err != nil {
-			return err
+// fileChange checks if the contents of a written or created file changed, a file renamed into place is created as well
+func (d *Detection) fileChange(ev fsnotify.Event, path string) (bool, error) {
+	if !utils.IsWrite(ev) && !utils.IsCreate(ev) {
+		return false, nil
+	}
+	return d.cacheFile(path)
+}
+
+// removal compares the cached files of the removed path with what is there by the end of the batch.
+// Files that are gone are changes, as are files replaced with different contents.
+func (d *Detection) removal(path string, changed *changes) error {
+	for _, file := range d.checksums.Paths(path) {
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			d.checksums.Remove(file)
+			changed.add(file, fsnotify.Remove)
+			continue
 		}
-	} else if utils.IsCreate(ev) {
-		if err := d.addIfIncluded(path); err != nil {
+		hasChanged, err := d.cacheFile(file)
+		if err != nil {
 			return err
 		}
+		if hasChanged {
+			changed.add(file, fsnotify.Write)
+		}
 	}
 	return nil
 }
+
+// unobserve stops watching the directories of the removed or renamed tree at path.
+// A renamed tree is observed again under its new name when its create event arrives.
+func (d *Detection) unobserve(path string) {
+	prefix := path + string(filepath.Separator)
+	for dir := range d.dirs {
+		if dir != path && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		// the operating system drops the watches of removed directories on its own
+		_ = d.environment.detector.Remove(dir)
+		delete(d.dirs, dir)
+	}
+}
+
+// changes collects the changed files of a batch, each file once
+type changes struct {
+	event.FilesChanged
+	seen map[string]bool
+}
+
+func newChanges() *changes {
+	return &changes{seen: make(map[string]bool)}
+}
+
+func (c *changes) add(path string, op fsnotify.Op) {
+	if c.seen[path] {
+		return
+	}
+	c.seen[path] = true
+	c.Paths = append(c.Paths, path)
+	c.Ops = append(c.Ops, op)
+}
+
+// merge adds the changes of the other, which were detected when the first of both was
+func (c *changes) merge(other *changes) {
+	if c.Detected.IsZero() || (!other.Detected.IsZero() && other.Detected.Before(c.Detected)) {
+		c.Detected = other.Detected
+	}
+	for i, path := range other.Paths {
+		c.add(path, other.Ops[i])
+	}
+}
+
+// isConfiguration checks if the path is the configuration file or its local configuration, which may not exist yet
+func (d *Detection) isConfiguration(path string) bool {
+	cfgPath := d.environment.config.Path
+	return cfgPath != "" && (path == cfgPath || path == configuration.LocalPath(cfgPath))
+}
+
+// reconfigure parses the changed configuration file and hands it over when it is valid
+func (d *Detection) reconfigure() {
+	// editors saving atomically replace the file which drops the watch on it
+	if err := d.observeConfiguration(); err != nil {
+		d.environment.logger.Main("error: during configuration observation: %s", err)
+	}
+
+	cfg, err := configuration.ParsedProfileConfiguration(d.environment.config.Path, d.environment.config.Profile)
+	if err != nil {
+		d.environment.logger.Main("error: invalid configuration, keeping the previous one: %s", err)
+		return
+	}
+	d.environment.events.Publish(event.ConfigurationChanged{At: time.Now(), Configuration: cfg})
+}
@@ -0,0 +1,304 @@
+package surveillance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+func TestNestedDirectories(t *testing.T) {
+	root := testTree(t, "nested")
+	d, sub, stop := runDetection(t)
+
+	file := filepath.Join(root, "a", "b", "c", "x.go")
+	writeTestFile(t, file, "package c\n")
+	waitForChange(t, sub, file)
+
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	writeTestFile(t, file, "package c\n\nconst changed = true\n")
+	waitForChange(t, sub, file)
+
+	stop()
+	if !d.dirs[filepath.Join(root, "a", "b", "c")] {
+		t.Error("want: the nested directory to be watched")
+	}
+}
+
+func TestBranchSwitch(t *testing.T) {
+	root := testTree(t, "branch")
+	writeTestFile(t, filepath.Join(root, "feature", "pkg", "old.go"), "package pkg\n")
+	d, sub, stop := runDetection(t)
+
+	if err := os.RemoveAll(filepath.Join(root, "feature")); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "other", "pkg", "new.go")
+	writeTestFile(t, file, "package pkg\n")
+	waitForChange(t, sub, file)
+
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	writeTestFile(t, file, "package pkg\n\nconst changed = true\n")
+	waitForChange(t, sub, file)
+
+	stop()
+	for dir := range d.dirs {
+		if strings.HasPrefix(dir, filepath.Join(root, "feature")) {
+			t.Errorf("want: the removed directory %s to be unwatched", dir)
+		}
+	}
+}
+
+func TestMovedTree(t *testing.T) {
+	root := testTree(t, "moved")
+	writeTestFile(t, filepath.Join(root, "old", "pkg", "z.go"), "package pkg\n")
+	_, sub, _ := runDetection(t)
+
+	if err := os.Rename(filepath.Join(root, "old"), filepath.Join(root, "new")); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "new", "pkg", "z.go")
+	waitForChange(t, sub, file)
+
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	writeTestFile(t, file, "package pkg\n\nconst changed = true\n")
+	paths := waitForChange(t, sub, file)
+	for _, path := range paths {
+		if strings.Contains(path, filepath.Join(root, "old")) {
+			t.Errorf("want: no changes reported below the old path, got: %s", path)
+		}
+	}
+}
+
+func TestAtomicSave(t *testing.T) {
+	root := testTree(t, "atomic")
+	file := filepath.Join(root, "x.go")
+	writeTestFile(t, file, "package atomic\n")
+	_, sub, _ := runDetection(t)
+
+	// like GoLand and most formatters, write a temporary file and rename it into place
+	tmp := filepath.Join(root, "x.go___jb_tmp___")
+	writeTestFile(t, tmp, "package atomic\n\nconst changed = true\n")
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	paths := waitForChange(t, sub, file)
+	for _, path := range paths {
+		if path == tmp {
+			t.Errorf("want: the temporary file to be skipped, got: %s", path)
+		}
+	}
+}
+
+func TestUnchangedSave(t *testing.T) {
+	root := testTree(t, "unchanged")
+	file := filepath.Join(root, "x.go")
+	writeTestFile(t, file, "package unchanged\n")
+	_, sub, _ := runDetection(t)
+
+	// like vim, move the original to a backup, write the same contents anew and remove the backup
+	backup := file + "~"
+	if err := os.Rename(file, backup); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, file, "package unchanged\n")
+	if err := os.Remove(backup); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(root, ".#x.go"), "")
+	expectNoChange(t, sub)
+}
+
+func TestRemovedFile(t *testing.T) {
+	root := testTree(t, "removed")
+	file := filepath.Join(root, "x.go")
+	writeTestFile(t, file, "package removed\n")
+	d, sub, stop := runDetection(t)
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	waitForChange(t, sub, file)
+
+	stop()
+	if d.checksums.Has(file) {
+		t.Error("want: the checksum of the removed file to be deleted")
+	}
+}
+
+func TestGitOperation(t *testing.T) {
+	root := testTree(t, "git")
+	gitDir := t.TempDir()
+	lock := filepath.Join(gitDir, "index.lock")
+	writeTestFile(t, lock, "")
+	_, sub, _ := runDetection(t, func(d *Detection) {
+		d.gitDir = gitDir
+		d.environment.config.Build.SettleTime = 200
+	})
+
+	// a checkout writes files at times while holding the index lock
+	first := filepath.Join(root, "a.go")
+	writeTestFile(t, first, "package git\n")
+	expectNoChange(t, sub)
+	second := filepath.Join(root, "b.go")
+	writeTestFile(t, second, "package git\n")
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
+	for {
+		select {
+		case ev := <-sub.Events():
+			changed, ok := ev.(event.FilesChanged)
+			if !ok {
+				continue
+			}
+			if len(changed.Paths) != 2 {
+				t.Fatalf("want: %s and %s changed at once, got: %v", first, second, changed.Paths)
+			}
+			return
+		case <-timeout:
+			t.Fatalf("want: %s and %s changed once git finished, got: none", first, second)
+		}
+	}
+}
+
+func TestExtraRoot(t *testing.T) {
+	extra := t.TempDir()
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Watch.Roots = []string{extra}
+	_, sub, _ := runDetectionWith(t, cfg)
+
+	// the excluded directories apply to every root
+	excluded := filepath.Join(extra, "tmp", "x.go")
+	writeTestFile(t, excluded, "package tmp\n")
+	file := filepath.Join(extra, "shared", "x.go")
+	writeTestFile(t, file, "package shared\n")
+	paths := waitForChange(t, sub, file)
+	for _, path := range paths {
+		if path == excluded {
+			t.Errorf("want: %s to be excluded", excluded)
+		}
+	}
+}
+
+// testTree is a directory below the root removed once the test finished
+func testTree(t *testing.T, relDir string) string {
+	root, err := utils.CurrentAbsolutePath(relDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := utils.RemoveAllDir(root); err != nil {
+			t.Error(err)
+		}
+	})
+	return root
+}
+
+// runDetection detects the changes of go files below the root until stopped or the test finished,
+// the detection is set up as provided before it runs
+func runDetection(t *testing.T, setups ...func(*Detection)) (*Detection, *event.Subscription, func()) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runDetectionWith(t, cfg, setups...)
+}
+
+// runDetectionWith is runDetection with the configuration provided
+func runDetectionWith(t *testing.T, cfg *configuration.Configuration, setups ...func(*Detection)) (*Detection, *event.Subscription, func()) {
+	cfg.Filter.IncludeExts = []string{"go"}
+	env, err := NewEnvironment(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := env.events.Subscribe()
+	d, err := NewDetection(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setup := range setups {
+		setup(d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Errorf("want: detection to keep running, got: %s", err)
+			}
+			if err := env.Teardown(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return d, sub, stop
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForChange waits until the file is reported as changed and returns every path reported until then
+func waitForChange(t *testing.T, sub *event.Subscription, file string) []string {
+	t.Helper()
+	var paths []string
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
+	for {
+		select {
+		case ev := <-sub.Events():
+			changed, ok := ev.(event.FilesChanged)
+			if !ok {
+				continue
+			}
+			paths = append(paths, changed.Paths...)
+			for _, path := range changed.Paths {
+				if path == file {
+					return paths
+				}
+			}
+		case <-timeout:
+			t.Fatalf("want: a change of %s, got: %v", file, paths)
+		}
+	}
+}
+
+// expectNoChange fails if a change is reported before the detection timeout
+func expectNoChange(t *testing.T, sub *event.Subscription) {
+	t.Helper()
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
+	for {
+		select {
+		case ev := <-sub.Events():
+			if changed, ok := ev.(event.FilesChanged); ok {
+				t.Fatalf("want: no change, got: %v", changed.Paths)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
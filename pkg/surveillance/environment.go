@@ -1,72 +1,134 @@
 package surveillance
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/AlexanderBrese/gomon/pkg/browsersync"
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/gotest"
 	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/monitor"
 	"github.com/AlexanderBrese/gomon/pkg/reload"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
 )
 
+// Environment holds the components of a configuration, it is torn down as a whole when the configuration changes
 type Environment struct {
 	config   *configuration.Configuration
 	detector *utils.Batcher
 	reloader *reload.Reload
+	tester   *gotest.Tester
 	sync     *browsersync.Server
+	monitor  *monitor.Monitor
 	logger   *logging.Logger
-
-	stopDetecting  chan bool
-	stopRefreshing chan bool
+	events   *event.Bus
+	logs     *event.Pending
 }
 
-func NewEnvironment(cfg *configuration.Configuration) (*Environment, error) {
-	batcher, err := utils.NewBatcher(cfg.BufferTime())
+func NewEnvironment(cfg *configuration.Configuration, opts ...Option) (*Environment, error) {
+	o := newOptions(opts)
+	if cfg.Reload {
+		if err := checkRunEnvironment(cfg); err != nil {
+			return nil, err
+		}
+	}
+	e := &Environment{
+		config: cfg,
+		logger: o.logger,
+		events: o.events,
+	}
+	if e.logger == nil {
+		e.logger = logging.NewLogger(cfg)
+	}
+	if o.probes == nil {
+		o.probes = utils.NewNotifyProbes(probeTimeout)
+	}
+	watcher, err := e.newWatcher(o.probes)
 	if err != nil {
 		return nil, err
 	}
-	e := &Environment{
-		config:         cfg,
-		detector:       batcher,
-		logger:         logging.NewLogger(cfg),
-		stopDetecting:  make(chan bool, 1),
-		stopRefreshing: make(chan bool, 1),
+	e.detector = utils.NewBatcher(watcher, cfg.Debounce())
+	if e.events == nil {
+		e.events = event.NewBus()
 	}
+	e.logs = e.events.Pend(func(event.Event) bool { return true }, event.Append)
+	go e.logger.Follow(e.logs)
 
 	if cfg.Reload {
 		e.reloader = reload.NewReload(cfg, e.logger)
-		if err := e.checkRunEnvironment(); err != nil {
-			return nil, err
+		e.reloader.Events = e.events
+		if o.builder != nil {
+			e.reloader.Builder = o.builder
 		}
+		if o.runner != nil {
+			e.reloader.Runner = o.runner
+		}
+	}
+
+	if cfg.Reload && cfg.IsMonitored() {
+		e.monitor = monitor.NewMonitor(cfg, e.logger, e.events)
+	}
+
+	if cfg.Test {
+		e.tester = gotest.NewTester(cfg)
+		e.tester.Events = e.events
 	}
 
 	if cfg.Sync {
-		e.sync = browsersync.NewServer(cfg.Build.Port, e.logger)
-		e.sync.Start()
+		e.sync = browsersync.NewServer(cfg.Build.Port, e.logger, e.events)
 	}
 
 	return e, nil
 }
 
+// Teardown stops the binary and the file watching, it returns once both are gone
 func (e *Environment) Teardown() error {
-	if e.config.Reload {
-		e.reloader.Cleanup()
-		<-e.reloader.FinishedKilling
-	}
-
-	if e.config.Sync {
-		if err := e.sync.Stop(); err != nil {
+	defer e.logs.Close()
+	if e.reloader != nil {
+		if err := e.reloader.Stop(); err != nil {
+			_ = e.detector.Close()
+			return err
+		}
+		if err := e.reloader.Close(); err != nil {
+			_ = e.detector.Close()
 			return err
 		}
 	}
+	return e.detector.Close()
+}
 
-	e.detector.Close()
-	e.stopDetecting <- true
-	e.stopRefreshing <- true
-	return nil
+// probeTimeout is how long the notification about the probe may take before polling is used instead
+const probeTimeout = time.Second
+
+// newWatcher creates the watcher of the configured backend. The auto backend polls if any of the watch roots
+// does not notify about changes, probing each root only once per Gomon.
+func (e *Environment) newWatcher(probes *utils.NotifyProbes) (utils.Watcher, error) {
+	switch e.config.Watch.Backend {
+	case configuration.WatchPoll:
+		return utils.NewPollWatcher(e.config.PollInterval()), nil
+	case configuration.WatchNotify:
+		return utils.NewNotifyWatcher()
+	}
+
+	roots, err := e.config.WatchRoots()
+	if err != nil {
+		return nil, err
+	}
+	unnotified, err := probes.Unnotified(append([]string{e.config.Root}, roots...))
+	if err != nil {
+		return nil, fmt.Errorf("during watcher probe: %w", err)
+	}
+	if unnotified != "" {
+		e.logger.Main("the file system of %s does not notify about changes, polling instead", unnotified)
+		return utils.NewPollWatcher(e.config.PollInterval()), nil
+	}
+	return utils.NewNotifyWatcher()
 }
 
-func (e *Environment) checkRunEnvironment() error {
-	buildDir, err := e.config.BuildDir()
+func checkRunEnvironment(cfg *configuration.Configuration) error {
+	buildDir, err := cfg.BuildDir()
 	if err != nil {
 		return err
 	}
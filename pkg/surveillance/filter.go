@@ -10,11 +10,14 @@ import (
 
 type Filter struct {
 	config *configuration.Configuration
+	// roots are the directories watched besides the root, the include directories only apply to the root
+	roots []string
 }
 
-func NewFilter(cfg *configuration.Configuration) *Filter {
+func NewFilter(cfg *configuration.Configuration, roots ...string) *Filter {
 	return &Filter{
 		config: cfg,
+		roots:  roots,
 	}
 }
 
@@ -38,7 +41,7 @@ func (f *Filter) IsExcludedDir(path string) (bool, error) {
 
 func (f *Filter) IsIncludedDir(dir string) (bool, error) {
 	incDirs := f.config.Filter.IncludeDirs
-	if len(incDirs) == 0 {
+	if len(incDirs) == 0 || f.root(dir) != f.config.Root {
 		return true, nil
 	}
 
@@ -55,6 +58,24 @@ func (f *Filter) IsIncludedDir(dir string) (bool, error) {
 	return false, nil
 }
 
+// IsAboveIncludedDir checks if an included directory is below the directory, which is watched then
+// to notice the included directory being created
+func (f *Filter) IsAboveIncludedDir(dir string) (bool, error) {
+	if f.root(dir) != f.config.Root {
+		return false, nil
+	}
+	for _, d := range f.config.Filter.IncludeDirs {
+		incDir, err := utils.CurrentAbsolutePath(d)
+		if err != nil {
+			return false, err
+		}
+		if utils.IsBelow(dir, incDir) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (f *Filter) IsBuildDir(path string) (bool, error) {
 	buildDir, err := f.config.BuildDir()
 	if err != nil {
@@ -76,7 +97,7 @@ func (f *Filter) IsHiddenDir(path string) bool {
 }
 
 func (f *Filter) IsIgnoredDir(path string) (bool, error) {
-	relPath, err := utils.RelPath(f.config.Root, path)
+	relPath, err := utils.RelPath(f.root(path), path)
 	if err != nil {
 		return false, err
 	}
@@ -91,12 +112,50 @@ func (f *Filter) IsIgnoredDir(path string) (bool, error) {
 	return false, nil
 }
 
+// root is the watched root the path is in, the innermost one if roots are nested
+func (f *Filter) root(path string) string {
+	root := f.config.Root
+	for _, r := range f.roots {
+		if utils.IsBelow(r, path) && (!utils.IsBelow(root, path) || len(r) > len(root)) {
+			root = r
+		}
+	}
+	return root
+}
+
 func (f *Filter) IsExcludedFile(path string) (bool, error) {
 	isIgnored, err := f.IsIgnoredFile(path)
 	if err != nil {
 		return false, err
 	}
-	return isIgnored || f.IsIgnoredExt(path), nil
+	return isIgnored || f.IsIgnoredExt(path) || f.IsTemporaryFile(path), nil
+}
+
+// temporaryPrefixes and temporarySuffixes match the names of the temporary, swap, backup and lock files
+// of editors and tools, which come and go while saving
+var (
+	temporaryPrefixes = []string{".#", ".goutputstream-", ".gomon-probe-"}
+	temporarySuffixes = []string{"~", ".swp", ".swo", ".swx", ".tmp", "___jb_tmp___", "___jb_old___"}
+)
+
+// IsTemporaryFile checks if the file is one of those editors write while saving
+func (f *Filter) IsTemporaryFile(path string) bool {
+	name := filepath.Base(path)
+	// vim checks if a directory is writable with a file named 4913, emacs auto saves to #name#
+	if name == "4913" || (len(name) > 1 && strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")) {
+		return true
+	}
+	for _, prefix := range temporaryPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	for _, suffix := range temporarySuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
 }
 
 func (f *Filter) IsIgnoredFile(path string) (bool, error) {
@@ -1,53 +1,157 @@
 package surveillance
 
-import "github.com/AlexanderBrese/gomon/pkg/configuration"
+import (
+	"context"
+	"errors"
+	"fmt"
 
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+// errReconfigured stops the components of an environment when the configuration changed
+var errReconfigured = errors.New("configuration changed")
+
+// Gomon watches for changes, rebuilds and restarts the binary and syncs the browser
 type Gomon struct {
+	options     []Option
 	environment *Environment
 	control     *Refresh
 	detection   *Detection
+	events      *event.Bus
+	ownsEvents  bool
+	timings     *Timings
 }
 
-func NewGomon(cfg *configuration.Configuration) *Gomon {
-	env, err := NewEnvironment(cfg)
-	if err != nil {
-		env.logger.Main("error: during environment initialization: %s", err)
-		return nil
+// New creates a Gomon with the configuration and options provided. It already watches the files, which
+// is only stopped by Run, so Run has to be called once for every Gomon created.
+func New(cfg *configuration.Configuration, opts ...Option) (*Gomon, error) {
+	c := &Gomon{events: newOptions(opts).events, timings: &Timings{}}
+	if c.events == nil {
+		c.events = event.NewBus()
+		c.ownsEvents = true
 	}
+	c.options = append(append([]Option{}, opts...), WithEvents(c.events), withProbes(utils.NewNotifyProbes(probeTimeout)))
+	if err := c.init(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	n := NewNotification()
-	ctrl := NewRefresh(env, n)
-	d, err := NewDetection(env, n)
+func (c *Gomon) init(cfg *configuration.Configuration) error {
+	env, err := NewEnvironment(cfg, c.options...)
 	if err != nil {
-		env.logger.Main("error: during detection initialization: %s", err)
+		return fmt.Errorf("during environment initialization: %w", err)
 	}
 
-	c := &Gomon{
-		environment: env,
-		control:     ctrl,
-		detection:   d,
+	ctrl := NewRefresh(env, c.timings)
+	d, err := NewDetection(env)
+	if err != nil {
+		if err := env.Teardown(); err != nil {
+			env.logger.Main("error: during environment teardown: %s", err)
+		}
+		return fmt.Errorf("during detection initialization: %w", err)
 	}
 
-	return c
+	c.environment = env
+	c.control = ctrl
+	c.detection = d
+	return nil
 }
 
-func (c *Gomon) Subscribe(sub chan bool) {
-	c.detection.notification = NewSubscriberNotification(sub)
+// Timings are the timings of the reload cycles completed so far
+func (c *Gomon) Timings() *Timings {
+	return c.timings
 }
 
-func (c *Gomon) Start() {
-	go func() {
-		if err := c.detection.Run(); err != nil {
-			c.environment.logger.Main("error: during detection: %s", err)
-			return
-		}
+// Subscribe returns a channel receiving every event from now on. Events are dropped
+// when the channel is not read in time and it is closed once Run returns, unless the
+// events are published to a bus provided with WithEvents.
+func (c *Gomon) Subscribe() <-chan event.Event {
+	return c.events.Subscribe().Events()
+}
+
+// Run watches, rebuilds and restarts until the context is done or a fatal error occurs.
+// Everything, including the binary, is stopped once it returns, and the timings of the session are logged.
+func (c *Gomon) Run(ctx context.Context) error {
+	if c.ownsEvents {
+		defer c.events.Close()
+	}
+	defer func() {
+		c.timings.log(c.environment.logger)
 	}()
-	c.control.Run()
+
+	for {
+		cfg, err := c.run(ctx)
+		if err != nil || cfg == nil {
+			if teardownErr := c.environment.Teardown(); teardownErr != nil {
+				if err != nil {
+					c.environment.logger.Main("error: during environment teardown: %s", teardownErr)
+					return err
+				}
+				return fmt.Errorf("during environment teardown: %w", teardownErr)
+			}
+			return err
+		}
+		if err := c.reconfigure(cfg); err != nil {
+			return err
+		}
+	}
+}
+
+// run runs the components of the current environment until one of them fails, the context is done
+// or the configuration changed, in which case the new configuration is returned
+func (c *Gomon) run(ctx context.Context) (*configuration.Configuration, error) {
+	g, ctx := errgroup.WithContext(ctx)
+	var cfg *configuration.Configuration
+	g.Go(func() error {
+		if err := c.detection.Run(ctx); err != nil {
+			return fmt.Errorf("during detection: %w", err)
+		}
+		return nil
+	})
+	g.Go(func() error {
+		var err error
+		cfg, err = c.control.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("during refresh: %w", err)
+		}
+		if cfg != nil {
+			return errReconfigured
+		}
+		return nil
+	})
+	if c.environment.sync != nil {
+		g.Go(func() error {
+			return c.environment.sync.Run(ctx)
+		})
+	}
+	if c.environment.monitor != nil {
+		g.Go(func() error {
+			return c.environment.monitor.Run(ctx)
+		})
+	}
+
+	if err := g.Wait(); !errors.Is(err, errReconfigured) {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func (c *Gomon) Stop() {
+// reconfigure tears the current environment down and starts over with the configuration provided,
+// falling back to the previous configuration when that fails
+func (c *Gomon) reconfigure(cfg *configuration.Configuration) error {
+	logger := c.environment.logger
+	prev := c.environment.config
 	if err := c.environment.Teardown(); err != nil {
-		c.environment.logger.Main("error: during environment teardown: %s", err)
-		return
+		return fmt.Errorf("during environment teardown: %w", err)
+	}
+	err := c.init(cfg)
+	if err == nil {
+		return nil
 	}
+	logger.Main("error: during reconfiguration, keeping the previous configuration: %s", err)
+	return c.init(prev)
 }
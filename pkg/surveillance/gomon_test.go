@@ -1,15 +1,24 @@
 package surveillance
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/reload"
 	"github.com/AlexanderBrese/gomon/pkg/utils"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/goleak"
 )
 
 const (
@@ -64,6 +73,15 @@ func testSuite() []Test {
 	customWatchedDirAndWatchedExt, _ := configuration.TestConfiguration()
 	customWatchedDirAndWatchedExt.Filter.IncludeDirs = append(customWatchedDirAndWatchedExt.Filter.IncludeDirs, "watched")
 	customWatchedDirAndWatchedExt.Filter.IncludeExts = append(customWatchedDirAndWatchedExt.Filter.IncludeExts, "go")
+	pollCfg, _ := configuration.TestConfiguration()
+	pollCfg.Filter.IncludeExts = append(pollCfg.Filter.IncludeExts, "go")
+	pollCfg.Watch.Backend = configuration.WatchPoll
+	pollCfg.Watch.PollInterval = 50
+	pollIncludeDirCfg, _ := configuration.TestConfiguration()
+	pollIncludeDirCfg.Filter.IncludeDirs = append(pollIncludeDirCfg.Filter.IncludeDirs, "watched")
+	pollIncludeDirCfg.Filter.IncludeExts = append(pollIncludeDirCfg.Filter.IncludeExts, "go")
+	pollIncludeDirCfg.Watch.Backend = configuration.WatchPoll
+	pollIncludeDirCfg.Watch.PollInterval = 50
 
 	return []Test{
 		{"Files in an ignored folder should not be detected.", customIgnoredDirCfg, "ignored/test.go", false},
@@ -78,20 +96,31 @@ func testSuite() []Test {
 		{"A file in a watched directory should be detected.", customIncludeDirCfg, "watched/test.go", true},
 		{"A file outside of a watched directory should not be detected.", customIncludeDirCfg, "other/test.go", false},
 		{"An ignored file should not be detected.", customIgnoredFileCfg, "ignored.go", false},
+		{"A file with a valid extension should be detected when polling.", pollCfg, "test.go", true},
+		{"An ignored file should not be detected when polling.", pollCfg, "test.custom", false},
+		{"A file in a created directory should be detected when polling.", pollCfg, "created/test.go", true},
+		{"A file in a watched directory should be detected when polling.", pollIncludeDirCfg, "watched/test.go", true},
+		{"A file outside of a watched directory should not be detected when polling.", pollIncludeDirCfg, "other/test.go", false},
 	}
 }
 
 func detect(cfg *configuration.Configuration, relFile string, shouldBeDetected bool) error {
-	gomon := NewGomon(cfg)
-	if gomon == nil {
-		return errors.New("error: during gomon initialization")
+	gomon, err := New(cfg)
+	if err != nil {
+		return err
 	}
-	subscription := subscribe(gomon)
-	go gomon.Start()
+	subscription := gomon.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(ctx)
+	}()
 
 	file := filepath.Join(cfg.Root, relFile)
 	defer func() {
-		if err := cleanup(file, relFile, subscription, gomon); err != nil {
+		cancel()
+		<-done
+		if err := cleanup(file, relFile); err != nil {
 			// TODO: log
 			return
 		}
@@ -107,32 +136,24 @@ func detect(cfg *configuration.Configuration, relFile string, shouldBeDetected b
 	return nil
 }
 
-func cleanup(file string, relFile string, sub chan bool, g *Gomon) error {
-	g.Stop()
-	close(sub)
+func cleanup(file string, relFile string) error {
 	if isInsideDir(relFile) {
 		dir, err := dir(relFile)
 		if err != nil {
 			return err
 		}
-		if err := delete(dir); err != nil {
+		if err := deletePath(dir); err != nil {
 			return err
 		}
 	} else {
-		if err := delete(file); err != nil {
+		if err := deletePath(file); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func subscribe(cd *Gomon) chan bool {
-	subscription := make(chan bool, 1)
-	cd.Subscribe(subscription)
-	return subscription
-}
-
-func delete(changedFile string) error {
+func deletePath(changedFile string) error {
 	return utils.RemoveAllDir(changedFile)
 }
 
@@ -201,22 +222,339 @@ func createTemporaryFile(path string) error {
 	return nil
 }
 
-func check(sub chan bool, shouldBeDetected bool) error {
+func check(sub <-chan event.Event, shouldBeDetected bool) error {
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
 	for {
 		select {
-		case detected, ok := <-sub:
+		case ev, ok := <-sub:
 			if !ok {
 				return nil
 			}
-			if !shouldBeDetected && detected {
+			if _, detected := ev.(event.FilesChanged); !detected {
+				continue
+			}
+			if !shouldBeDetected {
 				return errors.New("error: expected no change detection got change detection")
 			}
-			if shouldBeDetected && !detected {
-				return errors.New("error: expected change detection got no change detection")
+			return nil
+		case <-timeout:
+			if shouldBeDetected {
+				return errors.New("error: expected change detection got none")
 			}
 			return nil
+		}
+	}
+}
+
+func TestReconfiguration(t *testing.T) {
+	cfgPath, err := utils.CurrentAbsolutePath("gomon.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := utils.CreateFile(cfgPath, []byte("[filter]\ninclude_exts = [\"go\"]\n")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := deletePath(cfgPath); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Path = cfgPath
+	cfg.Layers = []string{cfgPath}
+	env, err := NewEnvironment(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := env.events.Subscribe()
+	d, err := NewDetection(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		if err := env.Teardown(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := utils.CreateFile(cfgPath, []byte("[filter]\ninclude_exts = [\"custom\"]\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
+	for {
+		select {
+		case ev := <-sub.Events():
+			reconfigured, ok := ev.(event.ConfigurationChanged)
+			if !ok {
+				continue
+			}
+			exts := reconfigured.Configuration.Filter.IncludeExts
+			if len(exts) != 1 || exts[0] != "custom" {
+				t.Errorf("want: [custom], got: %v", exts)
+			}
+			return
+		case <-timeout:
+			t.Error("error: expected reconfiguration got none")
+			return
+		}
+	}
+}
+
+type fakeBuilder struct {
+	builds chan bool
+}
+
+func (b *fakeBuilder) Build(ctx context.Context, out io.Writer) error {
+	b.builds <- true
+	return nil
+}
+
+type fakeRunner struct {
+	killed chan bool
+}
+
+func (r *fakeRunner) Run(stdout io.Writer, stderr io.Writer) (reload.Process, error) {
+	return r, nil
+}
+
+func (r *fakeRunner) Pid() int {
+	return 42
+}
+
+func (r *fakeRunner) Kill() error {
+	close(r.killed)
+	return nil
+}
+
+func (r *fakeRunner) Wait() (int, error) {
+	<-r.killed
+	return 0, nil
+}
+
+func TestInjectedBuilderAndRunner(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reload = true
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	builder := &fakeBuilder{builds: make(chan bool, 1)}
+	runner := &fakeRunner{killed: make(chan bool)}
+	gomon, err := New(cfg, WithBuilder(builder), WithRunner(runner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := gomon.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(ctx)
+	}()
+
+	select {
+	case <-builder.builds:
+	case <-time.After(changeDetectionTimeout * time.Millisecond):
+		t.Fatal("error: expected the injected builder to build")
+	}
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-runner.killed:
+	default:
+		t.Error("error: expected the injected process to be killed")
+	}
+
+	var got []string
+	for ev := range sub {
+		switch ev := ev.(type) {
+		case event.BuildStarted, event.BuildFinished:
+			got = append(got, reflect.TypeOf(ev).Name())
+		case event.AppStarted:
+			got = append(got, fmt.Sprintf("AppStarted %d", ev.Pid))
+		case event.AppExited:
+			got = append(got, fmt.Sprintf("AppExited %d", ev.Code))
+		}
+	}
+	want := []string{"BuildStarted", "BuildFinished", "AppStarted 42", "AppExited 0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+}
+
+// blockingBuilder builds once released
+type blockingBuilder struct {
+	builds  chan bool
+	release chan bool
+}
+
+func (b *blockingBuilder) Build(ctx context.Context, out io.Writer) error {
+	b.builds <- true
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func TestChangesSurviveAFloodDuringABuild(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reload = true
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	bus := event.NewBus()
+	builder := &blockingBuilder{builds: make(chan bool, 1), release: make(chan bool)}
+	gomon, err := New(cfg, WithEvents(bus), WithBuilder(builder), WithRunner(restartingRunner{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	awaitBuild := func(which string) {
+		select {
+		case <-builder.builds:
 		case <-time.After(changeDetectionTimeout * time.Millisecond):
-			return nil
+			t.Fatalf("error: expected the %s build", which)
+		}
+	}
+	changed := func() event.FilesChanged {
+		now := time.Now()
+		return event.FilesChanged{At: now, Paths: []string{filepath.Join(cfg.Root, "main.go")}, Ops: []fsnotify.Op{fsnotify.Write}, Detected: now}
+	}
+	flood := func() {
+		for i := 0; i < 1000; i++ {
+			bus.Publish(event.ResourcesSampled{At: time.Now(), Pid: 42})
 		}
 	}
+
+	awaitBuild("first")
+	builder.release <- true
+	bus.Publish(changed())
+	awaitBuild("second")
+	// the telemetry fills every subscription while the build blocks the refresh
+	flood()
+	bus.Publish(changed())
+	flood()
+	builder.release <- true
+	awaitBuild("third")
+	builder.release <- true
+}
+
+func TestShutdownDoesNotLeak(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reload = true
+	cfg.Sync = true
+	cfg.Build.Port = freePort(t)
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	builder := &fakeBuilder{builds: make(chan bool, 1)}
+	runner := &fakeRunner{killed: make(chan bool)}
+	gomon, err := New(cfg, WithBuilder(builder), WithRunner(runner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(ctx)
+	}()
+
+	<-builder.builds
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFatalErrorIsReturned(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Sync = true
+	cfg.Build.Port = l.Addr().(*net.TCPAddr).Port
+	gomon, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-runAsync(gomon):
+		if err == nil {
+			t.Error("error: expected the occupied sync port to be returned as error")
+		}
+	case <-time.After(changeDetectionTimeout * time.Millisecond):
+		t.Error("error: expected Run to return on a fatal error")
+	}
+}
+
+func runAsync(gomon *Gomon) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(context.Background())
+	}()
+	return done
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
 }
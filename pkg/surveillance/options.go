@@ -0,0 +1,62 @@
+package surveillance
+
+import (
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+	"github.com/AlexanderBrese/gomon/pkg/reload"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+// Option customizes Gomon, e.g. when it is embedded into another program
+type Option func(*options)
+
+type options struct {
+	logger  *logging.Logger
+	builder reload.Builder
+	runner  reload.Runner
+	events  *event.Bus
+	probes  *utils.NotifyProbes
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLogger replaces the logger created from the configuration
+func WithLogger(l *logging.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithBuilder replaces the configured build command
+func WithBuilder(b reload.Builder) Option {
+	return func(o *options) {
+		o.builder = b
+	}
+}
+
+// WithRunner replaces the configured execution command
+func WithRunner(r reload.Runner) Option {
+	return func(o *options) {
+		o.runner = r
+	}
+}
+
+// WithEvents publishes the events to the bus provided instead of one owned by Gomon
+func WithEvents(b *event.Bus) Option {
+	return func(o *options) {
+		o.events = b
+	}
+}
+
+// withProbes reuses the probes of the watch roots across the environments of a Gomon
+func withProbes(p *utils.NotifyProbes) Option {
+	return func(o *options) {
+		o.probes = p
+	}
+}
@@ -1,52 +1,162 @@
 package surveillance
 
+import (
+	"context"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/fsnotify/fsnotify"
+)
+
 type Refresh struct {
-	environment  *Environment
-	notification *Notification
+	environment *Environment
+	// changes holds the changes of files and configuration, which are never dropped while a reload is in progress
+	changes *event.Pending
+	// subscription follows the starts and syncs completing the cycles
+	subscription *event.Subscription
+	// tests is the test run in progress, canceled once newer changes arrive
+	tests *testRun
+	// timings collects the timings of the cycles completed
+	timings *Timings
+}
+
+// testRun is a test run in the background
+type testRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// paths are the changed files the run tests for
+	paths []string
 }
 
-func NewRefresh(env *Environment, n *Notification) *Refresh {
+func NewRefresh(env *Environment, timings *Timings) *Refresh {
 	return &Refresh{
 		environment:  env,
-		notification: n,
+		changes:      env.events.Pend(isChange, mergeChanges),
+		subscription: env.events.Subscribe(),
+		timings:      timings,
 	}
 }
 
-func (c *Refresh) Run() {
-	startupRun := make(chan bool, 1)
-	startupRun <- true
+// Run refreshes on every change until the context is done or the configuration changed, in which case the new configuration is returned
+func (c *Refresh) Run(ctx context.Context) (*configuration.Configuration, error) {
+	defer c.changes.Close()
+	defer c.subscription.Close()
+	defer c.cancelTests()
+	if err := c.reload(ctx, time.Time{}); err != nil {
+		return nil, err
+	}
 	for {
 		select {
-		case <-c.environment.stopRefreshing:
-			c.notification.Stop()
-			close(c.environment.stopRefreshing)
-			return
-		case <-c.notification.ChangeDetected():
-			c.log()
-		case <-startupRun:
-			break
+		case <-ctx.Done():
+			return nil, nil
+		case <-c.changes.Ready():
+			switch ev := c.changes.Take().(type) {
+			case event.ConfigurationChanged:
+				return ev.Configuration, nil
+			case event.FilesChanged:
+				untested := c.cancelTests()
+				if err := c.reload(ctx, ev.Detected); err != nil {
+					return nil, err
+				}
+				c.test(ctx, append(untested, ev.Paths...))
+			}
+		case ev, ok := <-c.subscription.Events():
+			if !ok {
+				return nil, nil
+			}
+			switch ev := ev.(type) {
+			case event.AppStarted:
+				if !c.environment.config.Sync {
+					c.complete(ev.Timing, ev.At)
+				}
+			case event.SyncSent:
+				c.complete(ev.Timing, ev.At)
+			}
 		}
+	}
+}
 
-		if c.reload() {
-			c.sync()
-		}
+func isChange(ev event.Event) bool {
+	switch ev.(type) {
+	case event.FilesChanged, event.ConfigurationChanged:
+		return true
 	}
+	return false
 }
 
-func (c *Refresh) log() {
-	c.environment.logger.Detection("%s", "change detected")
+// mergeChanges merges the changes arriving during a reload into one, a changed configuration restarts everything and wins
+func mergeChanges(pending event.Event, ev event.Event) event.Event {
+	files, ok := pending.(event.FilesChanged)
+	if !ok {
+		if _, ok := ev.(event.ConfigurationChanged); ok {
+			return ev
+		}
+		return pending
+	}
+	changed, ok := ev.(event.FilesChanged)
+	if !ok {
+		return ev
+	}
+	merged := event.FilesChanged{
+		At:       changed.At,
+		Paths:    append(append([]string{}, files.Paths...), changed.Paths...),
+		Ops:      append(append([]fsnotify.Op{}, files.Ops...), changed.Ops...),
+		Detected: files.Detected,
+	}
+	if merged.Detected.IsZero() || (!changed.Detected.IsZero() && changed.Detected.Before(merged.Detected)) {
+		merged.Detected = changed.Detected
+	}
+	return merged
 }
 
-func (c *Refresh) reload() bool {
+// reload rebuilds and restarts the binary for the changes detected at the time provided, zero for the first build
+func (c *Refresh) reload(ctx context.Context, detected time.Time) error {
 	if c.environment.config.Reload {
-		c.environment.reloader.Run()
-		return <-c.environment.reloader.FinishedRunning
+		return c.environment.reloader.Run(ctx, detected)
 	}
-	return false
+	return nil
 }
 
-func (c *Refresh) sync() {
-	if c.environment.config.Sync {
-		c.environment.sync.Sync()
+// complete publishes the timing of the cycle completed at the time provided, the first build follows no change and is not timed
+func (c *Refresh) complete(timing event.Timing, at time.Time) {
+	if timing.Detected.IsZero() {
+		return
+	}
+	cycle := event.CycleTimed{At: time.Now(), Timing: timing, Total: at.Sub(timing.Detected)}
+	c.timings.add(cycle)
+	c.environment.events.Publish(cycle)
+}
+
+// test starts testing the packages affected by the changed files in the background
+func (c *Refresh) test(ctx context.Context, paths []string) {
+	if !c.environment.config.Test {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	run := &testRun{cancel: cancel, done: make(chan struct{}), paths: paths}
+	c.tests = run
+	go func() {
+		defer close(run.done)
+		c.environment.tester.Run(ctx, paths)
+	}()
+}
+
+// cancelTests cancels the test run in progress and waits until it stopped,
+// the changed files it did not finish testing for are returned
+func (c *Refresh) cancelTests() []string {
+	run := c.tests
+	if run == nil {
+		return nil
+	}
+	c.tests = nil
+	select {
+	case <-run.done:
+		run.cancel()
+		return nil
+	default:
 	}
+	run.cancel()
+	<-run.done
+	return run.paths
 }
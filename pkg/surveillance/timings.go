@@ -0,0 +1,97 @@
+package surveillance
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/logging"
+)
+
+// Timings collects the timings of the reload cycles of a session, across reconfigurations
+type Timings struct {
+	mu     sync.Mutex
+	cycles []event.CycleTimed
+}
+
+func (t *Timings) add(cycle event.CycleTimed) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cycles = append(t.cycles, cycle)
+}
+
+// Percentile are the durations of the stages of the cycles at a percentile
+type Percentile struct {
+	Wait    time.Duration
+	Build   time.Duration
+	Startup time.Duration
+	Total   time.Duration
+}
+
+// Percentile is the percentile p of the cycles collected, zero without cycles
+func (t *Timings) Percentile(p int) Percentile {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stage := func(duration func(event.CycleTimed) time.Duration) time.Duration {
+		durations := make([]time.Duration, len(t.cycles))
+		for i, c := range t.cycles {
+			durations[i] = duration(c)
+		}
+		return percentile(durations, p)
+	}
+	return Percentile{
+		Wait:    stage(func(c event.CycleTimed) time.Duration { return c.Timing.Wait }),
+		Build:   stage(func(c event.CycleTimed) time.Duration { return c.Timing.Build }),
+		Startup: stage(func(c event.CycleTimed) time.Duration { return c.Timing.Startup }),
+		Total:   stage(func(c event.CycleTimed) time.Duration { return c.Total }),
+	}
+}
+
+// Len is the number of cycles collected
+func (t *Timings) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.cycles)
+}
+
+// log logs the p50 and p95 of the session, unless no cycle completed
+func (t *Timings) log(l *logging.Logger) {
+	n := t.Len()
+	if n == 0 {
+		return
+	}
+	p50, p95 := t.Percentile(50), t.Percentile(95)
+	l.Status("%d reload cycles, p50/p95: wait %s/%s, build %s/%s, %s %s/%s, total %s/%s", n,
+		round(p50.Wait), round(p95.Wait), round(p50.Build), round(p95.Build),
+		logging.StartupStage(t.isReady()), round(p50.Startup), round(p95.Startup), round(p50.Total), round(p95.Total))
+}
+
+// isReady checks if the startups of every cycle lasted until the binary was ready, they are only spawn times otherwise
+func (t *Timings) isReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.cycles {
+		if !c.Timing.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// percentile is the nearest-rank percentile p of the durations, which are sorted for it
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	rank := (p*len(durations) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return durations[rank-1]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,112 @@
+package surveillance
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlexanderBrese/gomon/pkg/configuration"
+	"github.com/AlexanderBrese/gomon/pkg/event"
+	"github.com/AlexanderBrese/gomon/pkg/reload"
+	"github.com/AlexanderBrese/gomon/pkg/utils"
+)
+
+func TestPercentile(t *testing.T) {
+	ms := func(ns ...int) []time.Duration {
+		durations := make([]time.Duration, len(ns))
+		for i, n := range ns {
+			durations[i] = time.Duration(n) * time.Millisecond
+		}
+		return durations
+	}
+	tests := []struct {
+		durations []time.Duration
+		p         int
+		want      time.Duration
+	}{
+		{nil, 50, 0},
+		{ms(7), 95, 7 * time.Millisecond},
+		{ms(4, 1, 3, 2), 50, 2 * time.Millisecond},
+		{ms(4, 1, 3, 2), 95, 4 * time.Millisecond},
+		{ms(10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 170, 180, 190, 200), 95, 190 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.durations, tt.p); got != tt.want {
+			t.Errorf("p%d of %v: got %s, want: %s", tt.p, tt.durations, got, tt.want)
+		}
+	}
+}
+
+type instantBuilder struct{}
+
+func (instantBuilder) Build(ctx context.Context, out io.Writer) error {
+	return nil
+}
+
+// restartingRunner starts a new process for every run
+type restartingRunner struct{}
+
+func (restartingRunner) Run(stdout io.Writer, stderr io.Writer) (reload.Process, error) {
+	return &fakeRunner{killed: make(chan bool)}, nil
+}
+
+func TestCycleTimed(t *testing.T) {
+	cfg, err := configuration.TestConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Reload = true
+	cfg.Filter.IncludeExts = append(cfg.Filter.IncludeExts, "go")
+	defer func() {
+		if err := utils.RemoveRootDir(cfg.Build.RelDir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	gomon, err := New(cfg, WithBuilder(instantBuilder{}), WithRunner(restartingRunner{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := gomon.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- gomon.Run(ctx)
+	}()
+
+	relFile := "timed.go"
+	file := filepath.Join(cfg.Root, relFile)
+	defer func() {
+		if err := cleanup(file, relFile); err != nil {
+			t.Error(err)
+		}
+	}()
+	time.Sleep(tempFileCreationDelay * time.Millisecond)
+	if err := do(relFile, file); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(changeDetectionTimeout * time.Millisecond)
+	for cycle := (event.CycleTimed{}); cycle.At.IsZero(); {
+		select {
+		case ev := <-sub:
+			if timed, ok := ev.(event.CycleTimed); ok {
+				cycle = timed
+			}
+		case <-timeout:
+			t.Fatal("error: expected the reload cycle to be timed")
+		}
+		if !cycle.At.IsZero() && (cycle.Timing.Detected.IsZero() || cycle.Total < cycle.Timing.Wait+cycle.Timing.Build) {
+			t.Errorf("got %+v, want the stages within the total", cycle)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if n := gomon.Timings().Len(); n != 1 {
+		t.Errorf("got %d cycles, want: 1", n)
+	}
+}
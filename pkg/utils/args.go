@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitArgs splits the command line into its arguments like a POSIX shell does without expanding anything:
+// at unquoted white space, with single quotes keeping everything, double quotes keeping all but escapes
+// and backslashes escaping the next character
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	isArg := false
+	var quote rune
+	isEscaped := false
+	for _, c := range s {
+		switch {
+		case isEscaped:
+			arg.WriteRune(c)
+			isEscaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+				continue
+			}
+			arg.WriteRune(c)
+		case c == '\\':
+			isEscaped, isArg = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+				continue
+			}
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, isArg = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if isArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				isArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			isArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if isEscaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if isArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
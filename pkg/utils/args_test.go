@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"go build -o", []string{"go", "build", "-o"}},
+		{"  -ldflags  '-s -w' ", []string{"-ldflags", "-s -w"}},
+		{`-ldflags="-X main.version=1.0 -s"`, []string{"-ldflags=-X main.version=1.0 -s"}},
+		{`path\ with\ spaces "a \"quoted\" word" ''`, []string{"path with spaces", `a "quoted" word`, ""}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.s)
+		if err != nil {
+			t.Errorf("%q: %s", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"'unterminated", `trailing\`} {
+		if _, err := SplitArgs(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
@@ -1,68 +1,197 @@
 package utils
 
 import (
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// Batcher collects detected file changes throughout a given time interval.
+// Debounce is how the Batcher groups the changes of a burst
+type Debounce struct {
+	// Quiet is for how long no change may arrive before the changes collected are flushed
+	Quiet time.Duration
+	// Leading flushes the first change of a burst at once, the rest once it is quiet
+	Leading bool
+	// MaxWait flushes the changes collected after this long even if the burst goes on, no limit if zero
+	MaxWait time.Duration
+	// BulkThreshold is from how many changes on a burst is a bulk change, like a branch switch, disabled if zero
+	BulkThreshold int
+	// Settle is for how long no change may arrive before bulk changes are flushed, regardless of MaxWait
+	Settle time.Duration
+}
+
+// Batcher collects detected file changes until no change arrived for a while.
 type Batcher struct {
-	*fsnotify.Watcher
-	interval time.Duration
-	done     chan struct{}
+	watcher   Watcher
+	debounce  Debounce
+	clock     Clock
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+
+	// the state of the current burst, only touched by run
+	evs     []fsnotify.Event
+	errs    []error
+	first   time.Time
+	last    time.Time
+	inBurst bool
 
 	Events chan []fsnotify.Event
 	Errors chan []error
 }
 
-// NewBatcher creates and runs a Batcher with the given time interval.
-func NewBatcher(interval time.Duration) (*Batcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
-	}
+// NewBatcher creates and runs a Batcher collecting the changes of the watcher as debounced.
+func NewBatcher(watcher Watcher, debounce Debounce) *Batcher {
+	return newBatcher(watcher, debounce, RealClock)
+}
 
+func newBatcher(watcher Watcher, debounce Debounce, clock Clock) *Batcher {
 	batcher := &Batcher{}
-	batcher.Watcher = watcher
-	batcher.interval = interval
-	batcher.done = make(chan struct{}, 1)
+	batcher.watcher = watcher
+	batcher.debounce = debounce
+	batcher.clock = clock
+	batcher.done = make(chan struct{})
+	batcher.stopped = make(chan struct{})
 	batcher.Events = make(chan []fsnotify.Event, 1)
+	batcher.Errors = make(chan []error, 1)
 
 	go batcher.run()
 
-	return batcher, err
+	return batcher
+}
+
+// Add watches the path provided
+func (b *Batcher) Add(path string) error {
+	return b.watcher.Add(path)
+}
+
+// Remove stops watching the path provided
+func (b *Batcher) Remove(path string) error {
+	return b.watcher.Remove(path)
 }
 
 func (b *Batcher) run() {
-	tick := time.NewTicker(b.interval)
-	evs := make([]fsnotify.Event, 0)
-	errs := make([]error, 0)
-OuterLoop:
+	defer close(b.stopped)
+	var timer Timer
+	var wake <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
 	for {
 		select {
-		case ev := <-b.Watcher.Events:
-			evs = append(evs, ev)
-		case err := <-b.Watcher.Errors:
-			errs = append(errs, err)
-		case <-tick.C:
-			if len(evs) != 0 {
-				b.Events <- evs
-				evs = make([]fsnotify.Event, 0)
+		case ev, ok := <-b.watcher.Events():
+			if !ok {
+				return
 			}
-			if len(errs) != 0 {
-				b.Errors <- errs
-				errs = make([]error, 0)
+			now := b.clock.Now()
+			if b.debounce.Leading && !b.inBurst {
+				b.inBurst = true
+				b.last = now
+				if !b.send([]fsnotify.Event{ev}, nil) {
+					return
+				}
+				break
 			}
+			b.collect(now)
+			b.evs = append(b.evs, ev)
+		case err, ok := <-b.watcher.Errors():
+			if !ok {
+				return
+			}
+			b.collect(b.clock.Now())
+			b.errs = append(b.errs, err)
+		case <-wake:
+			now := b.clock.Now()
+			quiet, maxWait := b.timing()
+			isQuiet := !now.Before(b.last.Add(quiet))
+			isCapped := maxWait > 0 && !now.Before(b.first.Add(maxWait))
+			if isQuiet || isCapped {
+				if !b.send(b.evs, b.errs) {
+					return
+				}
+				b.evs, b.errs = nil, nil
+			}
+			if isQuiet {
+				b.inBurst = false
+			}
+		case <-b.done:
+			return
+		}
+
+		// an idle Batcher sleeps until the next change
+		if timer != nil {
+			timer.Stop()
+			timer, wake = nil, nil
+		}
+		if at, ok := b.deadline(); ok {
+			timer = b.clock.NewTimer(at.Sub(b.clock.Now()))
+			wake = timer.C()
+		}
+	}
+}
+
+// collect notes the time of a change kept for the next flush
+func (b *Batcher) collect(now time.Time) {
+	if len(b.evs) == 0 && len(b.errs) == 0 {
+		b.first = now
+	}
+	b.last = now
+}
+
+// deadline is when the changes collected have to be flushed or the burst ends, false if there is neither
+func (b *Batcher) deadline() (time.Time, bool) {
+	isPending := len(b.evs) != 0 || len(b.errs) != 0
+	if !isPending && !b.inBurst {
+		return time.Time{}, false
+	}
+	quiet, maxWait := b.timing()
+	at := b.last.Add(quiet)
+	if isPending && maxWait > 0 {
+		if capped := b.first.Add(maxWait); capped.Before(at) {
+			at = capped
+		}
+	}
+	return at, true
+}
+
+// timing is how long the current burst has to be quiet and may be collected at most,
+// bulk changes are collected until they settled so that they are acted on once
+func (b *Batcher) timing() (quiet time.Duration, maxWait time.Duration) {
+	if b.debounce.BulkThreshold > 0 && len(b.evs) >= b.debounce.BulkThreshold {
+		return b.debounce.Settle, 0
+	}
+	return b.debounce.Quiet, b.debounce.MaxWait
+}
+
+// send hands over the changes unless the Batcher is closed, it returns false once it is
+func (b *Batcher) send(evs []fsnotify.Event, errs []error) bool {
+	if len(evs) != 0 {
+		select {
+		case b.Events <- evs:
+		case <-b.done:
+			return false
+		}
+	}
+	if len(errs) != 0 {
+		select {
+		case b.Errors <- errs:
 		case <-b.done:
-			break OuterLoop
+			return false
 		}
 	}
-	close(b.done)
+	return true
 }
 
-// Close stops the Batcher
-func (b *Batcher) Close() {
-	b.done <- struct{}{}
-	b.Watcher.Close()
+// Close stops the Batcher and waits until it stopped, it may be called more than once
+func (b *Batcher) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.done)
+		<-b.stopped
+		err = b.watcher.Close()
+	})
+	return err
 }
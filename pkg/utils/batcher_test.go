@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const testQuiet = 100 * time.Millisecond
+
+func TestTrailingDebounce(t *testing.T) {
+	d := newDebounceTest(t, Debounce{Quiet: testQuiet})
+
+	// a burst straddling what used to be a tick is a single batch
+	d.change("a")
+	d.advance(60 * time.Millisecond)
+	d.change("b")
+	d.advance(60 * time.Millisecond)
+	d.change("c")
+	d.expectNoBatch()
+	d.advance(testQuiet)
+	d.expectBatch("a", "b", "c")
+
+	// an idle Batcher does not wake up
+	d.change("d")
+	d.expectTimers(4)
+}
+
+func TestLeadingDebounce(t *testing.T) {
+	d := newDebounceTest(t, Debounce{Quiet: testQuiet, Leading: true})
+
+	d.change("a")
+	d.expectBatch("a")
+	d.advance(10 * time.Millisecond)
+	d.change("b")
+	d.advance(10 * time.Millisecond)
+	d.change("c")
+	d.expectNoBatch()
+	d.advance(testQuiet)
+	d.expectBatch("b", "c")
+
+	// the burst ended, the next change is a batch at once
+	d.change("d")
+	d.expectBatch("d")
+	d.advance(testQuiet)
+	d.change("e")
+	d.expectBatch("e")
+}
+
+func TestMaxWaitDebounce(t *testing.T) {
+	d := newDebounceTest(t, Debounce{Quiet: testQuiet, MaxWait: 250 * time.Millisecond})
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		d.change(name)
+		d.advance(50 * time.Millisecond)
+	}
+	d.change("e")
+	d.expectNoBatch()
+	d.advance(50 * time.Millisecond)
+	d.expectBatch("a", "b", "c", "d", "e")
+
+	d.change("f")
+	d.advance(testQuiet)
+	d.expectBatch("f")
+}
+
+func TestBulkDebounce(t *testing.T) {
+	d := newDebounceTest(t, Debounce{Quiet: testQuiet, MaxWait: 250 * time.Millisecond, BulkThreshold: 3, Settle: 500 * time.Millisecond})
+
+	// a branch switch writing a file at times goes on beyond the quiet period and the max wait
+	d.change("a")
+	d.change("b")
+	d.change("c")
+	d.advance(testQuiet)
+	d.expectNoBatch()
+	d.change("d")
+	d.advance(400 * time.Millisecond)
+	d.change("e")
+	d.advance(400 * time.Millisecond)
+	d.expectNoBatch()
+	d.advance(100 * time.Millisecond)
+	d.expectBatch("a", "b", "c", "d", "e")
+
+	// smaller bursts are debounced as usual
+	d.change("f")
+	d.advance(testQuiet)
+	d.expectBatch("f")
+}
+
+// debounceTest drives a Batcher with a fake watcher and clock
+type debounceTest struct {
+	t       *testing.T
+	clock   *fakeClock
+	watcher *fakeWatcher
+	batcher *Batcher
+}
+
+func newDebounceTest(t *testing.T, debounce Debounce) *debounceTest {
+	d := &debounceTest{
+		t:       t,
+		clock:   &fakeClock{t: t, now: time.Unix(0, 0), started: make(chan struct{}, 100)},
+		watcher: &fakeWatcher{events: make(chan fsnotify.Event), errors: make(chan error)},
+	}
+	d.batcher = newBatcher(d.watcher, debounce, d.clock)
+	t.Cleanup(func() {
+		if err := d.batcher.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return d
+}
+
+// change hands a change to the Batcher and waits until it timed its flush
+func (d *debounceTest) change(name string) {
+	d.t.Helper()
+	d.watcher.events <- fsnotify.Event{Name: name, Op: fsnotify.Write}
+	select {
+	case <-d.clock.started:
+	case <-time.After(time.Second):
+		d.t.Fatalf("want: a timer started for %s, got: none", name)
+	}
+}
+
+func (d *debounceTest) advance(by time.Duration) {
+	d.t.Helper()
+	d.clock.advance(by)
+}
+
+func (d *debounceTest) expectBatch(names ...string) {
+	d.t.Helper()
+	select {
+	case evs := <-d.batcher.Events:
+		if len(evs) != len(names) {
+			d.t.Fatalf("want: %v, got: %v", names, evs)
+		}
+		for i, ev := range evs {
+			if ev.Name != names[i] {
+				d.t.Fatalf("want: %v, got: %v", names, evs)
+			}
+		}
+	case <-time.After(time.Second):
+		d.t.Fatalf("want: %v, got: none", names)
+	}
+}
+
+func (d *debounceTest) expectNoBatch() {
+	d.t.Helper()
+	select {
+	case evs := <-d.batcher.Events:
+		d.t.Fatalf("want: no batch, got: %v", evs)
+	default:
+	}
+}
+
+func (d *debounceTest) expectTimers(want int) {
+	d.t.Helper()
+	d.clock.mu.Lock()
+	defer d.clock.mu.Unlock()
+	if len(d.clock.timers) != want {
+		d.t.Errorf("want: %d timers started, got: %d", want, len(d.clock.timers))
+	}
+}
+
+// fakeClock only moves when advanced, its timers fire once their Batcher received them
+type fakeClock struct {
+	t       *testing.T
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	started chan struct{}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time)}
+	c.timers = append(c.timers, timer)
+	c.started <- struct{}{}
+	return timer
+}
+
+func (c *fakeClock) advance(by time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(by)
+	now := c.now
+	var due []*fakeTimer
+	for _, timer := range c.timers {
+		if !timer.stopped && !timer.fired && !timer.at.After(now) {
+			timer.fired = true
+			due = append(due, timer)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, timer := range due {
+		select {
+		case timer.c <- now:
+		case <-time.After(time.Second):
+			c.t.Fatal("want: the timer to be received, got: none")
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	c       chan time.Time
+	stopped bool
+	fired   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := !t.stopped && !t.fired
+	t.stopped = true
+	return wasActive
+}
+
+type fakeWatcher struct {
+	events chan fsnotify.Event
+	errors chan error
+}
+
+func (w *fakeWatcher) Add(path string) error         { return nil }
+func (w *fakeWatcher) Remove(path string) error      { return nil }
+func (w *fakeWatcher) Events() <-chan fsnotify.Event { return w.events }
+func (w *fakeWatcher) Errors() <-chan error          { return w.errors }
+func (w *fakeWatcher) Close() error                  { return nil }
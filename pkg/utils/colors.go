@@ -1,6 +1,10 @@
 package utils
 
-import "github.com/fatih/color"
+import (
+	"sort"
+
+	"github.com/fatih/color"
+)
 
 var colors = map[string]color.Attribute{
 	"green":   color.FgGreen,
@@ -12,6 +16,22 @@ var colors = map[string]color.Attribute{
 	"white":   color.FgWhite,
 }
 
+// IsColor checks if the color name provided is known
+func IsColor(colorName string) bool {
+	_, ok := colors[colorName]
+	return ok
+}
+
+// ColorNames are the known color names in alphabetical order
+func ColorNames() []string {
+	names := make([]string, 0, len(colors))
+	for name := range colors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func Color(colorName string) *color.Color {
 	return color.New(colors[colorName])
 }
@@ -1,50 +1,192 @@
 package utils
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// suspicionWindow is how recently a file may have been modified for its metadata not to be trusted,
+// as file systems with a coarse modification time miss writes within the same tick
+const suspicionWindow = 2 * time.Second
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// Checksum identifies the contents of a file by its metadata and the hash of its contents
+type Checksum struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Inode   uint64 `json:"inode"`
+	Hash    uint64 `json:"hash"`
+	// Checked is when the checksum was taken, in nanoseconds since the epoch
+	Checked int64 `json:"checked"`
+}
+
+// sameMetadata checks if the metadata of the file is the same
+func (c Checksum) sameMetadata(o Checksum) bool {
+	return c.Size == o.Size && c.ModTime == o.ModTime && c.Inode == o.Inode
+}
+
+// isTrusted checks if the file was modified long enough before the checksum was taken for its metadata to tell changes
+func (c Checksum) isTrusted() bool {
+	return time.Duration(c.Checked-c.ModTime) >= suspicionWindow
+}
+
 // FileChecksums is a thread-safe map that stores file checksums
 type FileChecksums struct {
 	lock    sync.Mutex
-	storage map[string]string
+	storage map[string]Checksum
+	// restored are the checksums of a previous run, they spare hashing files that did not change since
+	restored map[string]Checksum
 }
 
 // NewFileChecksums creates a new file checksums map
 func NewFileChecksums() *FileChecksums {
-	return &FileChecksums{storage: make(map[string]string)}
+	return &FileChecksums{storage: make(map[string]Checksum)}
+}
+
+// Update takes the checksum of the file and reports whether it is new or changed in a thread-safe manner.
+// The contents are only hashed when the metadata changed or cannot be trusted.
+func (c *FileChecksums) Update(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	checksum := Checksum{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   inode(info),
+		Checked: time.Now().UnixNano(),
+	}
+
+	c.lock.Lock()
+	prev, known := c.storage[path]
+	restored, isRestored := c.restored[path]
+	c.lock.Unlock()
+
+	switch {
+	case known && prev.sameMetadata(checksum) && prev.isTrusted():
+		return false, nil
+	case !known && isRestored && restored.sameMetadata(checksum) && restored.isTrusted():
+		checksum.Hash = restored.Hash
+		checksum.Checked = restored.Checked
+	default:
+		checksum.Hash, err = FileHash(path)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.storage[path] = checksum
+	return !known || prev.Hash != checksum.Hash, nil
 }
 
-// UpdateFileChecksum updates the checksum for the given path in a thread-safe manner
-func (c *FileChecksums) UpdateFileChecksum(path string, checksum string) {
+// Has checks if there is a checksum for the given path in a thread safe manner
+func (c *FileChecksums) Has(path string) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	c.storage[path] = checksum
+	_, ok := c.storage[path]
+	return ok
 }
 
-// HasChanged checks if the checksum for the given path has changed in a thread safe manner
-func (c *FileChecksums) HasChanged(path string, checksum string) bool {
+// Remove removes the checksum for the given path in a thread safe manner
+func (c *FileChecksums) Remove(path string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	return checksum != c.storage[path]
+	delete(c.storage, path)
 }
 
-// FileChecksum calculates a new checksum for the given path
-func FileChecksum(path string) (string, error) {
-	contents, err := ioutil.ReadFile(path)
+// Paths returns the paths with a checksum that are the given path or below it in a thread safe manner
+func (c *FileChecksums) Paths(path string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var paths []string
+	prefix := path + string(filepath.Separator)
+	for p := range c.storage {
+		if p == path || strings.HasPrefix(p, prefix) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Sum hashes the paths and contents of all files with a checksum in a thread safe manner,
+// it is the same whenever the files return to the same contents
+func (c *FileChecksums) Sum() uint64 {
+	c.lock.Lock()
+	paths := make([]string, 0, len(c.storage))
+	for p := range c.storage {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := crc64.New(crcTable)
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%x\x00", p, c.storage[p].Hash)
+	}
+	c.lock.Unlock()
+	return h.Sum64()
+}
+
+// Restore reads the checksums saved by a previous run, a missing file is no error
+func (c *FileChecksums) Restore(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
-		return "", err
+		return err
+	}
+	restored := make(map[string]Checksum)
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return err
 	}
 
-	h := sha256.New()
-	if _, err := h.Write(contents); err != nil {
-		return "", err
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.restored = restored
+	return nil
+}
+
+// Save writes the checksums for the next run to restore
+func (c *FileChecksums) Save(path string) error {
+	c.lock.Lock()
+	data, err := json.Marshal(c.storage)
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
 	}
+	return ioutil.WriteFile(path, data, 0o644)
+}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+// FileHash streams the contents of the file into a non-cryptographic hash
+func FileHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc64.New(crcTable)
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum64(), nil
 }
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileChecksums(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	writeFile(t, file, "package main\n")
+	c := NewFileChecksums()
+
+	expectUpdate(t, c, file, true)
+	expectUpdate(t, c, file, false)
+
+	// a recently modified file is hashed, so a write of the same size within the same tick is noticed
+	writeFile(t, file, "package mian\n")
+	expectUpdate(t, c, file, true)
+
+	// a save with the same contents replaces the file but does not change it
+	tmp := file + ".tmp"
+	writeFile(t, tmp, "package mian\n")
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	expectUpdate(t, c, file, false)
+}
+
+func TestFileChecksumsTrustOldMetadata(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	writeFile(t, file, "package main\n")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	c := NewFileChecksums()
+	expectUpdate(t, c, file, true)
+
+	// the contents of a file whose metadata did not change are not read
+	rewrite(t, file, "package mian\n", old)
+	expectUpdate(t, c, file, false)
+}
+
+func TestFileChecksumsRestore(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	writeFile(t, file, "package main\n")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	c := NewFileChecksums()
+	expectUpdate(t, c, file, true)
+	cache := filepath.Join(dir, "cache", "checksums.json")
+	if err := c.Save(cache); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewFileChecksums()
+	if err := restored.Restore(cache); err != nil {
+		t.Fatal(err)
+	}
+	rewrite(t, file, "package mian\n", old)
+	expectUpdate(t, restored, file, true)
+	if restored.storage[file].Hash != c.storage[file].Hash {
+		t.Error("want: the restored checksum to be in use")
+	}
+
+	if err := NewFileChecksums().Restore(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("want: a missing cache to be no error, got: %s", err)
+	}
+}
+
+func TestFileChecksumsSum(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	writeFile(t, file, "package main\n")
+	c := NewFileChecksums()
+	expectUpdate(t, c, file, true)
+	before := c.Sum()
+
+	writeFile(t, file, "package mian\n")
+	expectUpdate(t, c, file, true)
+	if c.Sum() == before {
+		t.Error("sum did not change with the contents")
+	}
+
+	// reverting the contents reverts the sum, even though the file was written again
+	writeFile(t, file, "package main\n")
+	expectUpdate(t, c, file, true)
+	if c.Sum() != before {
+		t.Error("sum did not return with the contents")
+	}
+}
+
+func expectUpdate(t *testing.T, c *FileChecksums, path string, want bool) {
+	t.Helper()
+	changed, err := c.Update(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != want {
+		t.Errorf("want: changed to be %t, got: %t", want, changed)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rewrite changes the contents of the file in place, keeping its size and modification time
+func rewrite(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+	writeFile(t, path, content)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
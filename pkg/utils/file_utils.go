@@ -35,6 +35,12 @@ func RelPath(root string, path string) (string, error) {
 	return s, nil
 }
 
+// IsBelow checks if the path is the directory provided or below it
+func IsBelow(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // CurrentRootPath is the current root path
 func CurrentRootPath() (string, error) {
 	wd, err := os.Getwd()
@@ -76,7 +82,7 @@ func CreateAllDirIfNotExist(path string) error {
 // RemoveFileIfExist removes a file if it does already exist at the path provided
 func RemoveFileIfExist(path string) error {
 	if err := CheckPath(path); err != nil {
-		return err
+		return nil
 	}
 	return RemoveFile(path)
 }
@@ -155,6 +161,11 @@ func IsRemove(ev fsnotify.Event) bool {
 	return ev.Op&fsnotify.Remove == fsnotify.Remove
 }
 
+// IsRename checks if the fsnotify event is a rename, reported for the old path
+func IsRename(ev fsnotify.Event) bool {
+	return ev.Op&fsnotify.Rename == fsnotify.Rename
+}
+
 // IsCreate checks if the fsnotify event is a create
 func IsCreate(ev fsnotify.Event) bool {
 	return ev.Op&fsnotify.Create == fsnotify.Create
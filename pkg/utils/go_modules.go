@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalModules are the absolute directories of the modules used by the go.work of the module at root,
+// and of those its go.mod replaces with local ones. Directories at or below root are left out.
+func LocalModules(root string) ([]string, error) {
+	var dirs []string
+
+	if work, ok := findGoWork(root); ok {
+		data, err := os.ReadFile(work)
+		if err != nil {
+			return nil, err
+		}
+		for _, args := range directives(data, "use") {
+			dirs = append(dirs, localPath(filepath.Dir(work), args[0]))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, args := range directives(data, "replace") {
+		for i, arg := range args {
+			if arg == "=>" && i+1 < len(args) && isLocalPath(args[i+1]) {
+				dirs = append(dirs, localPath(root, args[i+1]))
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var modules []string
+	for _, dir := range dirs {
+		if seen[dir] || IsBelow(root, dir) {
+			continue
+		}
+		seen[dir] = true
+		modules = append(modules, dir)
+	}
+	sort.Strings(modules)
+	return modules, nil
+}
+
+// ModuleFiles are the files of the module at root pinning its dependencies and their sources, which are go.mod,
+// go.sum, vendor/modules.txt and the go.work in use with its go.work.sum. Only those existing are returned.
+func ModuleFiles(root string) []string {
+	candidates := []string{
+		filepath.Join(root, "go.mod"),
+		filepath.Join(root, "go.sum"),
+		filepath.Join(root, "vendor", "modules.txt"),
+	}
+	if work, ok := findGoWork(root); ok {
+		candidates = append(candidates, work, work+".sum")
+	}
+	var files []string
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// findGoWork looks for the go.work file in the directory provided and its parents, like the go command
+func findGoWork(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// directives are the arguments of every directive with the name provided in a go.mod or go.work file,
+// written on a line of their own or in a block
+func directives(data []byte, name string) [][]string {
+	var args [][]string
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock:
+			args = append(args, unquote(fields))
+		case fields[0] == name && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == name && len(fields) > 1:
+			args = append(args, unquote(fields[1:]))
+		}
+	}
+	return args
+}
+
+func unquote(fields []string) []string {
+	for i, field := range fields {
+		if s, err := strconv.Unquote(field); err == nil {
+			fields[i] = s
+		}
+	}
+	return fields
+}
+
+// isLocalPath checks if the replacement is a directory rather than a module path
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+func localPath(base string, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, filepath.FromSlash(path))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocalModules(t *testing.T) {
+	workspace := t.TempDir()
+	root := filepath.Join(workspace, "app")
+	writeTree(t, map[string]string{
+		filepath.Join(workspace, "go.work"): "go 1.18\n\nuse (\n\t./app\n\t./shared // the models\n\t\"./tools\"\n)\nuse ./shared\n",
+		filepath.Join(root, "go.mod"): "module example.com/app\n\ngo 1.18\n\nrequire example.com/lib v1.0.0\n\n" +
+			"replace example.com/lib => ../lib\n\nreplace (\n\texample.com/remote v1.0.0 => example.com/fork v1.1.0\n\texample.com/internal => ./internal\n)\n",
+	})
+
+	modules, err := LocalModules(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(workspace, "lib"),
+		filepath.Join(workspace, "shared"),
+		filepath.Join(workspace, "tools"),
+	}
+	if !reflect.DeepEqual(modules, want) {
+		t.Errorf("want: %v, got: %v", want, modules)
+	}
+}
+
+func TestNoLocalModules(t *testing.T) {
+	modules, err := LocalModules(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 0 {
+		t.Errorf("want: no modules, got: %v", modules)
+	}
+}
+
+func writeTree(t *testing.T, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, path, content)
+	}
+}
@@ -0,0 +1,14 @@
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode is the inode number of the file, a file replaced by a rename has a new one
+func inode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
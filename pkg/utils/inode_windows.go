@@ -0,0 +1,8 @@
+package utils
+
+import "os"
+
+// inode is unknown on windows, size and modification time are compared only
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
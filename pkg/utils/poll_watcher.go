@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileState is what the PollWatcher compares a file by
+type fileState struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// PollWatcher compares the paths added at an interval, for file systems that do not notify about changes
+type PollWatcher struct {
+	interval time.Duration
+	mu       sync.Mutex
+	// watches maps the paths added to the states of themselves or their directory entries
+	watches   map[string]map[string]fileState
+	checksums *FileChecksums
+
+	events    chan fsnotify.Event
+	errors    chan error
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPollWatcher creates and runs a PollWatcher with the given interval
+func NewPollWatcher(interval time.Duration) *PollWatcher {
+	w := &PollWatcher{
+		interval:  interval,
+		watches:   make(map[string]map[string]fileState),
+		checksums: NewFileChecksums(),
+		events:    make(chan fsnotify.Event),
+		errors:    make(chan error),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add starts comparing the path, and the entries if it is a directory
+func (w *PollWatcher) Add(path string) error {
+	states, err := w.scan(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watches[filepath.Clean(path)] = states
+	return nil
+}
+
+// Remove stops comparing the path
+func (w *PollWatcher) Remove(path string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.watches, filepath.Clean(path))
+	return nil
+}
+
+func (w *PollWatcher) Events() <-chan fsnotify.Event {
+	return w.events
+}
+
+func (w *PollWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Close stops polling and waits until it stopped, it may be called more than once
+func (w *PollWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		<-w.stopped
+	})
+	return nil
+}
+
+func (w *PollWatcher) run() {
+	defer close(w.stopped)
+	tick := time.NewTicker(w.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if !w.poll() {
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// poll compares every watched path with its previous state, it returns false once the watcher is closed
+func (w *PollWatcher) poll() bool {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.watches))
+	for path := range w.watches {
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+
+	for _, path := range paths {
+		states, err := w.scan(path)
+		// like the operating system, the watch of a removed path is dropped. An empty directory stays watched.
+		removed := errors.Is(err, os.ErrNotExist)
+		if removed {
+			states = map[string]fileState{}
+		} else if err != nil {
+			if !w.send(nil, err) {
+				return false
+			}
+			continue
+		}
+
+		w.mu.Lock()
+		prev, ok := w.watches[path]
+		if ok {
+			w.watches[path] = states
+		}
+		w.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		for _, ev := range w.compare(prev, states) {
+			if !w.send(&ev, nil) {
+				return false
+			}
+		}
+		if removed {
+			if err := w.Remove(path); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compare creates the events that turn the previous states into the current ones
+func (w *PollWatcher) compare(prev map[string]fileState, curr map[string]fileState) []fsnotify.Event {
+	var evs []fsnotify.Event
+	for path, state := range curr {
+		before, ok := prev[path]
+		switch {
+		case !ok:
+			evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Create})
+			// like the operating system, the contents written into a new file are a write of their own
+			if !state.isDir && state.size > 0 {
+				evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Write})
+			}
+		case state.isDir != before.isDir:
+			evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Remove}, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case state.isDir:
+		case state.size != before.size || !state.modTime.Equal(before.modTime):
+			evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		case time.Since(state.modTime) < suspicionWindow && w.hasChecksumChanged(path):
+			evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+	for path := range prev {
+		if _, ok := curr[path]; !ok {
+			w.checksums.Remove(path)
+			evs = append(evs, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+		}
+	}
+	return evs
+}
+
+// hasChecksumChanged compares the contents of a file that looks the same, the first comparison never reports a change
+func (w *PollWatcher) hasChecksumChanged(path string) bool {
+	known := w.checksums.Has(path)
+	changed, err := w.checksums.Update(path)
+	return err == nil && known && changed
+}
+
+func (w *PollWatcher) send(ev *fsnotify.Event, err error) bool {
+	if ev != nil {
+		select {
+		case w.events <- *ev:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	select {
+	case w.errors <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// scan is the state of the file, or of the entries of the directory, at the path provided
+func (w *PollWatcher) scan(path string) (map[string]fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return map[string]fileState{filepath.Clean(path): newFileState(info)}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[string]fileState, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		states[filepath.Join(path, entry.Name())] = newFileState(info)
+	}
+	return states, nil
+}
+
+func newFileState(info os.FileInfo) fileState {
+	return fileState{size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+}
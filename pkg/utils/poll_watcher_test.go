@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	testPollInterval = 20 * time.Millisecond
+	testPollTimeout  = 500 * time.Millisecond
+)
+
+func TestPollWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w := NewPollWatcher(testPollInterval)
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.go")
+
+	if err := os.WriteFile(file, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Create)
+
+	if err := os.WriteFile(file, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Write)
+
+	// a file system with a coarse modification time misses a write of the same size within the same tick
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * testPollInterval)
+	if err := os.WriteFile(file, []byte("package main\n\nfunc mian() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Write)
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Remove)
+}
+
+func TestPollWatcherDropsRemovedWatches(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "watched")
+	if err := os.Mkdir(watched, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(watched, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := NewPollWatcher(testPollInterval)
+	defer w.Close()
+	if err := w.Add(watched); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(watched); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Remove)
+	time.Sleep(3 * testPollInterval)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watches[watched]; ok {
+		t.Error("want: the watch of the removed directory to be dropped")
+	}
+}
+
+func TestPollWatcherKeepsEmptyDirectories(t *testing.T) {
+	dir := t.TempDir()
+	w := NewPollWatcher(testPollInterval)
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory created empty gets its first file only after some polls
+	time.Sleep(3 * testPollInterval)
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, w, file, fsnotify.Create)
+}
+
+func expectEvent(t *testing.T, w Watcher, path string, op fsnotify.Op) {
+	t.Helper()
+	timeout := time.After(testPollTimeout)
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Name == path && ev.Op == op {
+				return
+			}
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("want: %s of %s, got: none", op, path)
+		}
+	}
+}
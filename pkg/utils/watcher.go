@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher reports changes of the paths added, and of the entries of added directories
+type Watcher interface {
+	Add(path string) error
+	Remove(path string) error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+	Close() error
+}
+
+// notifyWatcher is notified about changes by the operating system
+type notifyWatcher struct {
+	watcher *fsnotify.Watcher
+}
+
+// NewNotifyWatcher creates a Watcher notified by the operating system, e.g. with inotify
+func NewNotifyWatcher() (Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &notifyWatcher{watcher: w}, nil
+}
+
+func (w *notifyWatcher) Add(path string) error {
+	return w.watcher.Add(path)
+}
+
+func (w *notifyWatcher) Remove(path string) error {
+	return w.watcher.Remove(path)
+}
+
+func (w *notifyWatcher) Events() <-chan fsnotify.Event {
+	return w.watcher.Events
+}
+
+func (w *notifyWatcher) Errors() <-chan error {
+	return w.watcher.Errors
+}
+
+func (w *notifyWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// ProbeNotify writes a file into the directory provided and reports whether the operating system
+// notified about it within the timeout. Bind mounts of Docker Desktop, NFS, vboxsf and some WSL
+// setups never notify about changes.
+func ProbeNotify(dir string, timeout time.Duration) (bool, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return false, err
+	}
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		return false, err
+	}
+
+	probe, err := os.CreateTemp(dir, ".gomon-probe-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(probe.Name())
+	if err := probe.Close(); err != nil {
+		return false, err
+	}
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return false, nil
+			}
+			if filepath.Clean(ev.Name) == filepath.Clean(probe.Name()) {
+				return true, nil
+			}
+		case err := <-w.Errors:
+			return false, err
+		case <-deadline:
+			return false, nil
+		}
+	}
+}
+
+// NotifyProbes remembers which directories the operating system notifies about changes in, so that each
+// directory is only probed once, e.g. not again when the configuration is reloaded
+type NotifyProbes struct {
+	timeout time.Duration
+	// probe is ProbeNotify, unless replaced in tests
+	probe func(dir string, timeout time.Duration) (bool, error)
+
+	mu       sync.Mutex
+	notified map[string]bool
+}
+
+// NewNotifyProbes creates NotifyProbes waiting for the notification about each probe up to the timeout
+func NewNotifyProbes(timeout time.Duration) *NotifyProbes {
+	return &NotifyProbes{timeout: timeout, probe: ProbeNotify, notified: make(map[string]bool)}
+}
+
+// Unnotified probes the directories not probed before at once, and returns the first of the directories
+// provided the operating system does not notify about changes in, empty if it notifies in all of them
+func (p *NotifyProbes) Unnotified(dirs []string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unprobed := make(map[string]bool)
+	for _, dir := range dirs {
+		if _, ok := p.notified[filepath.Clean(dir)]; !ok {
+			unprobed[filepath.Clean(dir)] = true
+		}
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		probed = make(map[string]bool)
+		errs   = make(map[string]error)
+	)
+	for dir := range unprobed {
+		wg.Add(1)
+		go func(dir string) {
+			defer wg.Done()
+			notified, err := p.probe(dir, p.timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			probed[dir], errs[dir] = notified, err
+		}(dir)
+	}
+	wg.Wait()
+
+	var firstErr error
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		// a failed probe is repeated the next time
+		if err := errs[dir]; err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if notified, ok := probed[dir]; ok {
+			p.notified[dir] = notified
+		}
+	}
+	if firstErr != nil {
+		return "", firstErr
+	}
+	for _, dir := range dirs {
+		if dir = filepath.Clean(dir); !p.notified[dir] {
+			return dir, nil
+		}
+	}
+	return "", nil
+}
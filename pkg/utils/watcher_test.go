@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifyProbes(t *testing.T) {
+	var mu sync.Mutex
+	probed := make(map[string]int)
+	failing := map[string]bool{"/flaky": true}
+	p := NewNotifyProbes(time.Second)
+	p.probe = func(dir string, timeout time.Duration) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		probed[dir]++
+		if failing[dir] {
+			return false, errors.New("probe failed")
+		}
+		return dir != "/mnt/nfs", nil
+	}
+
+	steps := []struct {
+		dirs       []string
+		unnotified string
+		isErr      bool
+	}{
+		{[]string{"/project", "/project/"}, "", false},
+		// a watch root on another file system polls
+		{[]string{"/project", "/mnt/nfs"}, "/mnt/nfs", false},
+		{[]string{"/project", "/flaky"}, "", true},
+		{[]string{"/project", "/mnt/nfs", "/flaky"}, "/mnt/nfs", false},
+	}
+	for i, step := range steps {
+		if i == len(steps)-1 {
+			failing["/flaky"] = false
+		}
+		unnotified, err := p.Unnotified(step.dirs)
+		if (err != nil) != step.isErr || unnotified != step.unnotified {
+			t.Errorf("step %d: want: %q and error %t, got: %q and %v", i, step.unnotified, step.isErr, unnotified, err)
+		}
+	}
+
+	// the directories are probed once, unless the probe failed
+	want := map[string]int{"/project": 1, "/mnt/nfs": 1, "/flaky": 2}
+	for dir, n := range want {
+		if probed[dir] != n {
+			t.Errorf("want: %s probed %d times, got: %d", dir, n, probed[dir])
+		}
+	}
+}
+
+func TestProbeNotify(t *testing.T) {
+	notified, err := ProbeNotify(t.TempDir(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !notified {
+		t.Error("want: the temporary directory notifying about changes, got: no notification")
+	}
+}